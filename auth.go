@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/slarwise/pole/vault"
+)
+
+// authConfig configures machine authentication, for when pole runs where no
+// one can log in interactively
+type authConfig struct {
+	Method   string `yaml:"method"`
+	Mount    string `yaml:"mount"`
+	RoleID   string `yaml:"role_id"`
+	SecretID string `yaml:"secret_id"`
+	JWTRole  string `yaml:"jwt_role"`
+	JWT      string `yaml:"jwt"`
+	JWTFile  string `yaml:"jwt_file"`
+}
+
+func (a *authConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&a.Method, "auth-method", os.Getenv("POLE_AUTH_METHOD"), "log in with `method` approle or jwt instead of using an existing token ($POLE_AUTH_METHOD)")
+	fs.StringVar(&a.Mount, "auth-mount", os.Getenv("POLE_AUTH_MOUNT"), "`path` where the auth method is mounted, defaults to the name of the method ($POLE_AUTH_MOUNT)")
+	fs.StringVar(&a.RoleID, "role-id", os.Getenv("POLE_ROLE_ID"), "approle role_id ($POLE_ROLE_ID)")
+	fs.StringVar(&a.SecretID, "secret-id", os.Getenv("POLE_SECRET_ID"), "approle secret_id ($POLE_SECRET_ID)")
+	fs.StringVar(&a.JWTRole, "jwt-role", os.Getenv("POLE_JWT_ROLE"), "`role` to log in as with jwt auth ($POLE_JWT_ROLE)")
+	fs.StringVar(&a.JWT, "jwt", os.Getenv("POLE_JWT"), "`token` to log in with using jwt auth ($POLE_JWT)")
+	fs.StringVar(&a.JWTFile, "jwt-file", os.Getenv("POLE_JWT_FILE"), "`file` containing the token to log in with using jwt auth ($POLE_JWT_FILE)")
+}
+
+// overrides returns base with the fields that are set in a replaced, so
+// that flags and environment variables take precedence over the config file
+func (a authConfig) overrides(base authConfig) authConfig {
+	for _, field := range []struct{ value, base *string }{
+		{&a.Method, &base.Method},
+		{&a.Mount, &base.Mount},
+		{&a.RoleID, &base.RoleID},
+		{&a.SecretID, &base.SecretID},
+		{&a.JWTRole, &base.JWTRole},
+		{&a.JWT, &base.JWT},
+		{&a.JWTFile, &base.JWTFile},
+	} {
+		if *field.value != "" {
+			*field.base = *field.value
+		}
+	}
+	return base
+}
+
+// token logs in with the configured auth method. The returned source
+// describes where the token came from.
+func (a authConfig) token(ctx context.Context, client vault.Client) (token string, source string, err error) {
+	mount := a.Mount
+	if mount == "" {
+		mount = a.Method
+	}
+	mount = strings.Trim(mount, "/")
+	source = fmt.Sprintf("%s login at auth/%s", a.Method, mount)
+	switch a.Method {
+	case "approle":
+		if a.RoleID == "" {
+			return "", source, fmt.Errorf("A role_id must be given with -role-id or POLE_ROLE_ID to log in with approle")
+		}
+		token, err = client.LoginAppRole(ctx, mount, a.RoleID, a.SecretID)
+	case "jwt":
+		jwt := a.JWT
+		if jwt == "" && a.JWTFile != "" {
+			bytes, err := os.ReadFile(expandHome(a.JWTFile))
+			if err != nil {
+				return "", source, fmt.Errorf("Failed to read jwt file: %s", err)
+			}
+			jwt = strings.TrimSpace(string(bytes))
+		}
+		if jwt == "" {
+			return "", source, fmt.Errorf("A jwt must be given with -jwt, -jwt-file, POLE_JWT or POLE_JWT_FILE to log in with jwt")
+		}
+		token, err = client.LoginJWT(ctx, mount, a.JWTRole, jwt)
+	default:
+		return "", source, fmt.Errorf("Unknown auth method %s, must be approle or jwt", a.Method)
+	}
+	return token, source, err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// CLIPBOARD_COMMANDS are tried in order until one of them is installed
+var CLIPBOARD_COMMANDS = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+func copyToClipboard(text string) error {
+	commands := CLIPBOARD_COMMANDS
+	if runtime.GOOS == "darwin" {
+		commands = [][]string{{"pbcopy"}}
+	}
+	for _, command := range commands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Failed to run %s: %s: %s", command[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("Found no clipboard command, install one of wl-copy, xclip or xsel")
+}
+
+// fields are the keys in the data of the secret, in the order they are shown
+func (u Ui) fields() []string {
+	fields := []string{}
+	for k := range u.Secret.Data {
+		fields = append(fields, k)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// copyField copies the value of the selected field in the secret
+func (u *Ui) copyField() command {
+	fields := u.fields()
+	if len(fields) == 0 {
+		u.Error = "The secret has no fields to copy"
+		return nil
+	}
+	field := fields[u.Field]
+	value := u.Secret.Data[field]
+	text, ok := value.(string)
+	if !ok {
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			u.Error = fmt.Sprintf("Failed to marshal %s: %s", field, err)
+			return nil
+		}
+		text = string(bytes)
+	}
+	return copyCommand(text, fmt.Sprintf("Copied %s", field))
+}
+
+// copyCommand copies the text to the clipboard and shows the message when it
+// is done
+func copyCommand(text, message string) command {
+	return func() tcell.Event {
+		if err := copyToClipboard(text); err != nil {
+			return &statusEvent{err: err}
+		}
+		return &statusEvent{message: message}
+	}
+}
+
+// copyAsCli copies the vault cli command that reads the secret, or one of
+// its fields
+func (u *Ui) copyAsCli() {
+	key, ok := u.selected()
+	if !ok {
+		u.Error = "No secret is selected"
+		return
+	}
+	const allFields = "all fields"
+	u.pick("Copy as cli", append([]string{allFields}, u.fields()...), nil, func(u *Ui, field string) command {
+		cli := u.Secret.Cli
+		if field != allFields {
+			mount := u.Mounts[u.CurrentMount]
+			cli = fmt.Sprintf("vault kv get -mount=%s -field=%s %s", mount, field, key)
+		}
+		return copyCommand(cli, fmt.Sprintf("Copied %s", cli))
+	})
+}
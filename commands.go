@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/slarwise/pole/vault"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: pole [flags] [command]
+
+Browse secrets in vault. Without a command, pole starts the terminal ui.
+
+Commands:
+  ls <mount>           List all keys in mount
+  get <mount> <key>    Print the secret at key as json
+  diff [-reveal] <secret> <secret>
+                       Compare the fields of two secrets, like
+                       secret/app/db secret2/app/db. Add @<version> for
+                       an earlier version, or give only @<version> as the
+                       second secret to compare two versions of the first.
+                       Exits with 1 if they differ.
+  drift [-values] [-json] <mount> <mount> [<mount>...]
+                       Report the paths that only some of the mounts have
+                       and the fields that only some of their secrets have.
+                       -values also reports fields with the same value in
+                       more than one mount. Exits with 1 if there is drift.
+  sync -from <profile>:<mount> -to <profile>:<mount>
+                       Copy the secrets in one mount to another, which can
+                       be in another vault server. Prints the plan before
+                       writing. Run pole sync -help for the options.
+  export [-format format] [-o path] <mount>[/<prefix>]
+                       Write every secret below the path as json, yaml or
+                       a directory of json files. -versions includes all
+                       versions and -metadata the metadata of the secrets.
+  import [-dry-run] <file or directory> <mount>[/<prefix>]
+                       Write the secrets in a json or yaml file, or in a
+                       directory of .env files, below the path. Prints the
+                       plan before writing and only writes secrets that
+                       haven't changed since the plan was made.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// errSecretsDiffer is returned by the diff command when the secrets differ,
+// so that pole can exit with 1 like diff does
+var errSecretsDiffer = errors.New("The secrets differ")
+
+// runCommand runs one of the non-interactive commands
+func runCommand(ctx context.Context, vaultClient vault.Client, args []string) error {
+	switch args[0] {
+	case "ls":
+		if len(args) != 2 {
+			return fmt.Errorf("Usage: pole ls <mount>")
+		}
+		keys, report, err := vaultClient.GetKeys(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		if len(report) > 0 {
+			fmt.Fprint(os.Stderr, report)
+		}
+	case "get":
+		if len(args) != 3 {
+			return fmt.Errorf("Usage: pole get <mount> <key>")
+		}
+		key := args[2]
+		if !strings.HasPrefix(key, "/") {
+			key = "/" + key
+		}
+		secret, err := vaultClient.GetSecret(ctx, args[1], key)
+		if err != nil {
+			return err
+		}
+		bytes, err := json.MarshalIndent(secret, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal secret: %s", err)
+		}
+		fmt.Printf("%s\n", bytes)
+	case "diff":
+		return diffCommand(ctx, vaultClient, args[1:])
+	case "drift":
+		return driftCommand(ctx, vaultClient, args[1:])
+	case "export":
+		return exportCommand(ctx, vaultClient, args[1:])
+	case "import":
+		return importCommand(ctx, vaultClient, args[1:])
+	default:
+		return fmt.Errorf("Unknown command %s, see pole -help", args[0])
+	}
+	return nil
+}
+
+func diffCommand(ctx context.Context, vaultClient vault.Client, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	reveal := flags.Bool("reveal", false, "show the values instead of masking them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("Usage: pole diff [-reveal] <mount>/<key>[@<version>] <mount>/<key>[@<version>]")
+	}
+	mounts, err := vaultClient.GetMounts(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get mounts: %s", err)
+	}
+	from, err := parseSecretRef(flags.Arg(0), mounts, secretRef{})
+	if err != nil {
+		return err
+	}
+	to, err := parseSecretRef(flags.Arg(1), mounts, from)
+	if err != nil {
+		return err
+	}
+	fromSecret, err := getRef(ctx, vaultClient, from)
+	if err != nil {
+		return err
+	}
+	toSecret, err := getRef(ctx, vaultClient, to)
+	if err != nil {
+		return err
+	}
+	diff := secretDiff{From: from, To: to, Changes: diffData(fromSecret.Data.Data, toSecret.Data.Data)}
+	fmt.Printf("--- %s\n+++ %s\n", from, to)
+	for _, change := range diff.Changes {
+		fmt.Println(change.line(*reveal))
+	}
+	if diff.differs() {
+		return errSecretsDiffer
+	}
+	return nil
+}
+
+// getRef is getSecretRef for the commands, which can be interrupted
+func getRef(ctx context.Context, vaultClient vault.Client, ref secretRef) (vault.Secret, error) {
+	if ref.Version == 0 {
+		return vaultClient.GetSecret(ctx, ref.Mount, ref.Key)
+	}
+	return vaultClient.GetSecretVersion(ctx, ref.Mount, ref.Key, ref.Version)
+}
+
+func driftCommand(ctx context.Context, vaultClient vault.Client, args []string) error {
+	flags := flag.NewFlagSet("drift", flag.ContinueOnError)
+	compareValues := flags.Bool("values", false, "report fields with the same value in more than one mount")
+	asJson := flags.Bool("json", false, "print the report as json instead of a table")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("Usage: pole drift [-values] [-json] <mount> <mount> [<mount>...]")
+	}
+	mounts := flags.Args()
+	keys := make(map[string][]string)
+	for _, mount := range mounts {
+		k, report, err := vaultClient.GetKeys(ctx, mount)
+		if err != nil {
+			return err
+		}
+		if len(report) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s", mount, report)
+		}
+		keys[mount] = k
+	}
+	get := func(mount, key string) (Secret, error) {
+		secret, err := vaultClient.GetSecret(ctx, mount, key)
+		return newSecret(secret), err
+	}
+	concurrency := vaultClient.Concurrency
+	if concurrency <= 0 {
+		concurrency = vault.DEFAULT_CONCURRENCY
+	}
+	drift := findDrift(mounts, keys, get, *compareValues, concurrency)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Failed to compare %s: %w", strings.Join(mounts, ", "), err)
+	}
+	if *asJson {
+		bytes, err := json.MarshalIndent(drift, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal drift report: %s", err)
+		}
+		fmt.Printf("%s\n", bytes)
+	} else if err := drift.writeTable(os.Stdout); err != nil {
+		return fmt.Errorf("Failed to write drift report: %s", err)
+	}
+	if len(drift.Entries) > 0 {
+		return errSecretsDiffer
+	}
+	return nil
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/slarwise/pole/vault"
+
+	"github.com/gdamore/tcell/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ENV_PROFILE is the name of the profile that is configured by VAULT_ADDR
+// and the other environment variables that the vault cli reads
+const ENV_PROFILE = "env"
+
+type Config struct {
+	DefaultProfile string `yaml:"default_profile"`
+	// DefaultMount is the mount to start on, profiles can override it
+	DefaultMount string `yaml:"default_mount"`
+	// InitialQuery is typed into the prompt on start
+	InitialQuery string              `yaml:"initial_query"`
+	ShowHelp     bool                `yaml:"show_help"`
+	Mouse        bool                `yaml:"mouse"`
+	ScrollOff    int                 `yaml:"scroll_off"`
+	Layout       layoutConfig        `yaml:"layout"`
+	Theme        themeConfig         `yaml:"theme"`
+	Keys         map[string][]string `yaml:"keys"`
+	Profiles     map[string]Profile  `yaml:"profiles"`
+}
+
+// themeConfig has a color for each part of the ui. Cursor and selected are
+// background colors, the rest are foreground colors.
+type themeConfig struct {
+	Key       string `yaml:"key"`
+	String    string `yaml:"string"`
+	Null      string `yaml:"null"`
+	Default   string `yaml:"default"`
+	Stats     string `yaml:"stats"`
+	Error     string `yaml:"error"`
+	Help      string `yaml:"help"`
+	Cursor    string `yaml:"cursor"`
+	Selected  string `yaml:"selected"`
+	Scrollbar string `yaml:"scrollbar"`
+}
+
+// DEFAULT_CONFIG is what is used for the settings that are not in the config
+// file
+var DEFAULT_CONFIG = Config{
+	ShowHelp:  true,
+	Mouse:     true,
+	ScrollOff: 4,
+	Layout: layoutConfig{
+		Orientation:     ORIENTATION_HORIZONTAL,
+		Split:           0.5,
+		SinglePaneWidth: 60,
+		Direction:       DIRECTION_BOTTOM_UP,
+	},
+	Theme: themeConfig{
+		Key:       "blue",
+		String:    "green",
+		Null:      "gray",
+		Default:   "default",
+		Stats:     "yellow",
+		Error:     "red",
+		Help:      "red",
+		Cursor:    "red",
+		Selected:  "black",
+		Scrollbar: "gray",
+	},
+}
+
+// Profile is how to connect to one vault cluster
+type Profile struct {
+	Address   string      `yaml:"address"`
+	Namespace string      `yaml:"namespace"`
+	Color     string      `yaml:"color"`
+	Token     tokenConfig `yaml:"token"`
+	Auth      authConfig  `yaml:"auth"`
+	TLS       tlsConfig   `yaml:"tls"`
+	// DefaultMount overrides the default mount in the config
+	DefaultMount string `yaml:"default_mount"`
+}
+
+type tokenConfig struct {
+	Env    string `yaml:"env"`
+	File   string `yaml:"file"`
+	Helper string `yaml:"helper"`
+	// value is the token itself, for profiles that pole creates, like the
+	// demo. It can't be set in the config file.
+	value string
+}
+
+type tlsConfig struct {
+	CACert     string `yaml:"ca_cert"`
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+	ServerName string `yaml:"server_name"`
+	SkipVerify bool   `yaml:"skip_verify"`
+}
+
+// configPath is $XDG_CONFIG_HOME/pole/config, or ~/.config/pole/config if
+// XDG_CONFIG_HOME is not set. POLE_CONFIG overrides it.
+func configPath() string {
+	if path, found := os.LookupEnv("POLE_CONFIG"); found {
+		return path
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = expandHome("~/.config")
+	}
+	return filepath.Join(configHome, "pole", "config")
+}
+
+// loadConfig reads the yaml config file at path. A missing file gives the
+// default config. Errors point at the line in the file that is wrong.
+func loadConfig(path string) (Config, error) {
+	config := DEFAULT_CONFIG
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return config, fmt.Errorf("Failed to read config: %s", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("Failed to parse config:\n%s", yamlErrorLines(path, err))
+	}
+	if err := config.validate(); err != nil {
+		var fieldErr fieldError
+		if !errors.As(err, &fieldErr) {
+			return config, fmt.Errorf("Invalid config %s: %s", path, err)
+		}
+		var root yaml.Node
+		if yaml.Unmarshal(contents, &root) != nil {
+			return config, fmt.Errorf("Invalid config %s: %s", path, err)
+		}
+		return config, fmt.Errorf("Invalid config:\n%s:%d: %s", path, nodeLine(&root, fieldErr.Field), err)
+	}
+	return config, nil
+}
+
+// fieldError is a validation error for the field at the path in the config
+// file
+type fieldError struct {
+	Field []string
+	Msg   string
+}
+
+func (e fieldError) Error() string {
+	return e.Msg
+}
+
+func fieldErrorf(field []string, format string, args ...any) fieldError {
+	return fieldError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlErrorLines formats the errors from the yaml decoder as path:line: msg,
+// one per line
+func yamlErrorLines(path string, err error) string {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+	lines := []string{}
+	for _, msg := range msgs {
+		if match := yamlLinePattern.FindStringSubmatch(msg); match != nil {
+			lines = append(lines, fmt.Sprintf("%s:%s: %s", path, match[1], match[2]))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", path, msg))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nodeLine finds the line of the field in the yaml document. If the field
+// doesn't exist, the line of its closest parent is returned.
+func nodeLine(node *yaml.Node, field []string) int {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return nodeLine(node.Content[0], field)
+	}
+	if len(field) == 0 {
+		return node.Line
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == field[0] {
+				if len(field) == 1 {
+					return node.Content[i].Line
+				}
+				return nodeLine(node.Content[i+1], field[1:])
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(field[0]); err == nil && i < len(node.Content) {
+			return nodeLine(node.Content[i], field[1:])
+		}
+	}
+	return node.Line
+}
+
+func (c Config) validate() error {
+	if _, found := c.Profiles[ENV_PROFILE]; found {
+		return fieldErrorf([]string{"profiles", ENV_PROFILE}, "The profile name %s is reserved for the profile configured by VAULT_ADDR", ENV_PROFILE)
+	}
+	if c.DefaultProfile != "" {
+		if _, found := c.Profiles[c.DefaultProfile]; !found {
+			return fieldErrorf([]string{"default_profile"}, "The default profile %s is not defined", c.DefaultProfile)
+		}
+	}
+	if c.ScrollOff < 0 {
+		return fieldErrorf([]string{"scroll_off"}, "scroll_off must not be negative")
+	}
+	if err := c.Layout.validate(); err != nil {
+		return err
+	}
+	for field, color := range c.Theme.colors() {
+		if _, ok := parseColor(color); !ok {
+			return fieldErrorf([]string{"theme", field}, "Unknown color %s for theme.%s", color, field)
+		}
+	}
+	actions := []string{}
+	for action := range c.Keys {
+		actions = append(actions, action)
+	}
+	slices.Sort(actions)
+	for _, action := range actions {
+		if _, found := ACTIONS[action]; !found {
+			return fieldErrorf([]string{"keys", action}, "Unknown action %s", action)
+		}
+		for i, k := range c.Keys[action] {
+			if _, err := parseSequence(k); err != nil {
+				return fieldErrorf([]string{"keys", action, strconv.Itoa(i)}, "%s", err)
+			}
+		}
+	}
+	if _, err := newKeymap(c.Keys); err != nil {
+		return fieldErrorf([]string{"keys"}, "%s", err)
+	}
+	for _, name := range profileNames(c.Profiles) {
+		p := c.Profiles[name]
+		field := func(f ...string) []string {
+			return append([]string{"profiles", name}, f...)
+		}
+		if p.Address == "" {
+			return fieldErrorf(field(), "Profile %s must have an address", name)
+		}
+		if _, ok := parseColor(p.Color); p.Color != "" && !ok {
+			return fieldErrorf(field("color"), "Profile %s has an unknown color %s", name, p.Color)
+		}
+		if p.Auth.Method != "" && p.Auth.Method != "approle" && p.Auth.Method != "jwt" {
+			return fieldErrorf(field("auth", "method"), "Profile %s has an unknown auth method %s, must be approle or jwt", name, p.Auth.Method)
+		}
+		set := 0
+		for _, source := range []string{p.Token.Env, p.Token.File, p.Token.Helper} {
+			if source != "" {
+				set++
+			}
+		}
+		if set > 1 {
+			return fieldErrorf(field("token"), "Profile %s must have at most one of token.env, token.file and token.helper", name)
+		}
+	}
+	return nil
+}
+
+func (t themeConfig) colors() map[string]string {
+	return map[string]string{
+		"key":       t.Key,
+		"string":    t.String,
+		"null":      t.Null,
+		"default":   t.Default,
+		"stats":     t.Stats,
+		"error":     t.Error,
+		"help":      t.Help,
+		"cursor":    t.Cursor,
+		"selected":  t.Selected,
+		"scrollbar": t.Scrollbar,
+	}
+}
+
+// parseColor accepts the color names and hex codes that tcell knows about,
+// and default for the default color of the terminal
+func parseColor(name string) (tcell.Color, bool) {
+	if name == "" || name == "default" {
+		return tcell.ColorDefault, true
+	}
+	color := tcell.GetColor(name)
+	return color, color != tcell.ColorDefault
+}
+
+// apply sets the styles that the ui is drawn with
+func (t themeConfig) apply() {
+	color := func(name string) tcell.Color {
+		c, _ := parseColor(name)
+		return c
+	}
+	STYLE_KEY = tcell.StyleDefault.Foreground(color(t.Key))
+	STYLE_STRING = tcell.StyleDefault.Foreground(color(t.String))
+	STYLE_NULL = tcell.StyleDefault.Foreground(color(t.Null))
+	STYLE_DEFAULT = tcell.StyleDefault.Foreground(color(t.Default))
+	STYLE_STATS = tcell.StyleDefault.Foreground(color(t.Stats))
+	STYLE_ERROR = tcell.StyleDefault.Foreground(color(t.Error))
+	STYLE_HELP = tcell.StyleDefault.Foreground(color(t.Help))
+	STYLE_CURSOR = tcell.StyleDefault.Background(color(t.Cursor))
+	STYLE_SELECTED = tcell.StyleDefault.Background(color(t.Selected))
+	STYLE_SCROLLBAR = tcell.StyleDefault.Foreground(color(t.Scrollbar))
+}
+
+// profiles returns all profiles by name, including the one configured by
+// VAULT_ADDR if it is set
+func (c Config) profiles() map[string]Profile {
+	profiles := make(map[string]Profile, len(c.Profiles)+1)
+	for name, p := range c.Profiles {
+		profiles[name] = p
+	}
+	if p, found := envProfile(); found {
+		profiles[ENV_PROFILE] = p
+	}
+	return profiles
+}
+
+// selectProfile picks the profile to start with. An explicitly requested
+// profile comes first, then the default profile in the config, then the
+// profile configured by VAULT_ADDR and lastly the first one by name.
+func (c Config) selectProfile(requested string) (string, error) {
+	profiles := c.profiles()
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("VAULT_ADDR must be set or a profile must be configured in %s", configPath())
+	}
+	if requested != "" {
+		if _, found := profiles[requested]; !found {
+			return "", fmt.Errorf("Unknown profile %s, the profiles are %s", requested, strings.Join(profileNames(profiles), ", "))
+		}
+		return requested, nil
+	}
+	if c.DefaultProfile != "" {
+		return c.DefaultProfile, nil
+	}
+	if _, found := profiles[ENV_PROFILE]; found {
+		return ENV_PROFILE, nil
+	}
+	return profileNames(profiles)[0], nil
+}
+
+func profileNames(profiles map[string]Profile) []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// envProfile is configured by the same environment variables as the vault
+// cli
+func envProfile() (Profile, bool) {
+	addr, found := os.LookupEnv("VAULT_ADDR")
+	if !found {
+		return Profile{}, false
+	}
+	skipVerify, _ := strconv.ParseBool(os.Getenv("VAULT_SKIP_VERIFY"))
+	return Profile{
+		Address:   addr,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		TLS: tlsConfig{
+			CACert:     os.Getenv("VAULT_CACERT"),
+			ClientCert: os.Getenv("VAULT_CLIENT_CERT"),
+			ClientKey:  os.Getenv("VAULT_CLIENT_KEY"),
+			ServerName: os.Getenv("VAULT_TLS_SERVER_NAME"),
+			SkipVerify: skipVerify,
+		},
+	}, true
+}
+
+// client creates a vault client for the profile, with its own cache
+func (p Profile) client() (vault.Client, error) {
+	httpClient, err := vault.TLSConfig{
+		CACert:     expandHome(p.TLS.CACert),
+		ClientCert: expandHome(p.TLS.ClientCert),
+		ClientKey:  expandHome(p.TLS.ClientKey),
+		ServerName: p.TLS.ServerName,
+		SkipVerify: p.TLS.SkipVerify,
+	}.HTTPClient()
+	if err != nil {
+		return vault.Client{}, err
+	}
+	return vault.NewClient(strings.TrimSuffix(p.Address, "/"),
+		vault.WithNamespace(p.Namespace),
+		vault.WithHTTPClient(httpClient),
+	), nil
+}
+
+func (p Profile) tokenSource() vault.TokenSource {
+	return vault.TokenSource{
+		Env:    p.Token.Env,
+		File:   expandHome(p.Token.File),
+		Helper: expandHome(p.Token.Helper),
+		Token:  p.Token.value,
+	}
+}
+
+// token logs in with the auth method of the profile if it has one, otherwise
+// it finds the token in the token source. The returned source describes
+// where the token came from.
+func (p Profile) token(ctx context.Context, client vault.Client) (token string, source string, err error) {
+	if p.Auth.Method != "" {
+		return p.Auth.token(ctx, client)
+	}
+	return p.tokenSource().Find()
+}
+
+// connect creates a client for the profile that has a token
+func (p Profile) connect(ctx context.Context) (vault.Client, error) {
+	client, err := p.client()
+	if err != nil {
+		return vault.Client{}, fmt.Errorf("Failed to create vault client: %s", err)
+	}
+	token, source, err := p.token(ctx, client)
+	if err != nil {
+		return vault.Client{}, fmt.Errorf("Failed to get a vault token from %s: %s", source, err)
+	}
+	client.Token = token
+	return client, nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"profiles": {
+			config: `
+default_profile: dev
+profiles:
+  dev:
+    address: http://127.0.0.1:8200
+  prod:
+    address: https://vault.example.com
+    namespace: team
+    color: red
+    token:
+      file: ~/.vault-token-prod
+    tls:
+      skip_verify: true
+`,
+		},
+		"empty": {
+			config: "",
+		},
+		"unknown-field": {
+			config: "profiles:\n  dev:\n    adress: http://127.0.0.1:8200\n",
+			err:    "config:3: field adress not found",
+		},
+		"settings": {
+			config: `
+default_mount: secret
+initial_query: db
+show_help: false
+scroll_off: 2
+layout:
+  split: 0.3
+theme:
+  key: "#ff8800"
+  selected: default
+keys:
+  quit: [Ctrl-Q]
+  move-up: [Ctrl-K, Alt-k]
+`,
+		},
+		"unknown-theme-color": {
+			config: "theme:\n  key: blue\n  cursor: reddish\n",
+			err:    "config:3: Unknown color reddish",
+		},
+		"split-out-of-range": {
+			config: "layout:\n  split: 1.5\n",
+			err:    "config:2: layout.split must be between",
+		},
+		"unknown-action": {
+			config: "keys:\n  quit: [Esc]\n  fly: [Ctrl-F]\n",
+			err:    "config:3: Unknown action fly",
+		},
+		"unknown-key": {
+			config: "keys:\n  quit:\n    - Esc\n    - Ctrl-Nope\n",
+			err:    "config:4: Unknown key Ctrl-Nope",
+		},
+		"key-bound-twice": {
+			config: "keys:\n  quit: [Ctrl-Q]\n  select: [Ctrl-Q]\n",
+			err:    "bound to both quit and select",
+		},
+		"missing-address": {
+			config: "profiles:\n  dev:\n    namespace: team\n",
+			err:    "config:2: Profile dev must have an address",
+		},
+		"unknown-default": {
+			config: "default_profile: prod\nprofiles:\n  dev:\n    address: http://127.0.0.1:8200\n",
+			err:    "The default profile prod is not defined",
+		},
+		"unknown-color": {
+			config: "profiles:\n  dev:\n    address: http://127.0.0.1:8200\n    color: reddish\n",
+			err:    "config:4: Profile dev has an unknown color reddish",
+		},
+		"two-token-sources": {
+			config: "profiles:\n  dev:\n    address: http://127.0.0.1:8200\n    token:\n      env: DEV_TOKEN\n      file: /tmp/token\n",
+			err:    "at most one of",
+		},
+		"reserved-name": {
+			config: "profiles:\n  env:\n    address: http://127.0.0.1:8200\n",
+			err:    "reserved",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(test.config), 0o644); err != nil {
+				t.Fatalf("Failed to write config: %s", err)
+			}
+			_, err := loadConfig(path)
+			if test.err == "" && err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("Expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	config := Config{
+		Profiles: map[string]Profile{
+			"prod":    {Address: "https://vault.example.com"},
+			"staging": {Address: "https://staging.vault.example.com"},
+		},
+	}
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+	tests := map[string]struct {
+		requested      string
+		defaultProfile string
+		unsetAddr      bool
+		profile        string
+		err            bool
+	}{
+		"requested":        {requested: "staging", defaultProfile: "prod", profile: "staging"},
+		"unknown":          {requested: "dev", err: true},
+		"default":          {defaultProfile: "prod", profile: "prod"},
+		"env":              {profile: ENV_PROFILE},
+		"first-by-name":    {unsetAddr: true, profile: "prod"},
+		"requested-env":    {requested: ENV_PROFILE, defaultProfile: "prod", profile: ENV_PROFILE},
+		"requested-no-env": {requested: ENV_PROFILE, unsetAddr: true, err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.unsetAddr {
+				t.Setenv("VAULT_ADDR", "")
+				os.Unsetenv("VAULT_ADDR")
+			}
+			config.DefaultProfile = test.defaultProfile
+			profile, err := config.selectProfile(test.requested)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error, got profile %s", profile)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if profile != test.profile {
+				t.Fatalf("Expected profile %s, got %s", test.profile, profile)
+			}
+		})
+	}
+}
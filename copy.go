@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// copyRequest is a copy or move of a secret, or of a directory, that is
+// being put together by the user
+type copyRequest struct {
+	move bool
+	// metadata copies the custom metadata as well
+	metadata bool
+	// verb, busy and done describe the copy or move in messages
+	verb   string
+	busy   string
+	done   string
+	copier SecretCopier
+	mount  string
+	source string
+	// toMount and toKey are the destination, toKey is a directory if source
+	// is
+	toMount string
+	toKey   string
+}
+
+func (r copyRequest) isDir() bool {
+	return strings.HasSuffix(r.source, "/")
+}
+
+// copySecret copies or moves the selected secret, or a directory that it is
+// in, to a path that the user types. The custom metadata is copied if asked
+// for, a move always takes it along. The user is asked before secrets are
+// overwritten and before moving, which destroys all versions of the source.
+func (u *Ui) copySecret(move, metadata bool) {
+	r := copyRequest{move: move, metadata: metadata || move, verb: "Copy", busy: "Copying...", done: "Copied"}
+	if move {
+		r.verb, r.busy, r.done = "Move", "Moving...", "Moved"
+	}
+	copier, ok := u.Store.(SecretCopier)
+	if !ok {
+		u.Error = fmt.Sprintf("Failed to %s, the store can't write secrets", strings.ToLower(r.verb))
+		return
+	}
+	r.copier = copier
+	key, ok := u.selected()
+	if !ok {
+		return
+	}
+	r.mount = u.Mounts[u.CurrentMount]
+	r.source = key
+	dirs := parentDirs(key)
+	if len(dirs) == 0 {
+		r.askDestination(u)
+		return
+	}
+	counts := map[string]int{}
+	for _, dir := range dirs {
+		for _, k := range u.Keys {
+			if strings.HasPrefix(k, dir) {
+				counts[dir]++
+			}
+		}
+	}
+	u.pick(r.verb+" "+r.mount+key+" or a directory", append([]string{key}, dirs...), func(option string) string {
+		if n, isDir := counts[option]; isDir {
+			return fmt.Sprintf("%d secrets", n)
+		}
+		return ""
+	}, func(u *Ui, source string) command {
+		r.source = source
+		r.askDestination(u)
+		return nil
+	})
+}
+
+// askDestination lets the user type where to copy the source to, and finds
+// the secrets that would be overwritten there
+func (r copyRequest) askDestination(u *Ui) {
+	u.input(fmt.Sprintf("%s %s%s to", r.verb, r.mount, r.source), r.mount+r.source, func(u *Ui, destination string) command {
+		toMount, toKey, err := splitMountPath(destination, u.Mounts)
+		if err != nil {
+			u.Error = err.Error()
+			return nil
+		}
+		if !r.isDir() && (toKey == "/" || strings.HasSuffix(toKey, "/")) {
+			toKey = strings.TrimSuffix(toKey, "/") + r.source[strings.LastIndex(r.source, "/"):]
+		}
+		if toMount == r.mount && strings.TrimSuffix(toKey, "/") == strings.TrimSuffix(r.source, "/") {
+			u.Error = fmt.Sprintf("Failed to %s %s%s, the source and destination are the same", strings.ToLower(r.verb), r.mount, r.source)
+			return nil
+		}
+		r.toMount, r.toKey = toMount, toKey
+		// The sources and the destinations of the secrets that would be
+		// written
+		ev := &copyCheckEvent{request: r, sources: []string{r.source}, destinations: []string{toKey}}
+		if r.isDir() {
+			ev.sources, ev.destinations = []string{}, []string{}
+			toPrefix := strings.TrimSuffix(toKey, "/") + "/"
+			for _, k := range u.Keys {
+				if rest, found := strings.CutPrefix(k, r.source); found {
+					ev.sources = append(ev.sources, k)
+					ev.destinations = append(ev.destinations, toPrefix+rest)
+				}
+			}
+		}
+		u.Busy = "Loading..."
+		store := u.Store
+		return func() tcell.Event {
+			ev.existing, _, ev.err = store.GetKeys(toMount)
+			if ev.err != nil {
+				return ev
+			}
+			if checker, ok := store.(CapabilityChecker); ok {
+				ev.denied, ev.err = r.denied(checker, ev.sources, ev.destinations, ev.existing)
+			}
+			return ev
+		}
+	})
+}
+
+// denied tells what the token isn't allowed to do for the copy, empty if it
+// can do all of it. Writing needs create for new secrets and update for the
+// ones that exist, and a move needs to delete all versions of the sources.
+func (r copyRequest) denied(checker CapabilityChecker, sources, destinations, existing []string) (string, error) {
+	capabilities, err := checker.GetCapabilities(r.toMount, destinations)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range destinations {
+		c := capabilities[d]
+		if slices.Contains(existing, d) && !c.Update {
+			return fmt.Sprintf("not allowed to update %s%s", r.toMount, d), nil
+		}
+		if !slices.Contains(existing, d) && !c.Create {
+			return fmt.Sprintf("not allowed to create %s%s", r.toMount, d), nil
+		}
+	}
+	if !r.move {
+		return "", nil
+	}
+	capabilities, err = checker.GetCapabilities(r.mount, sources)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range sources {
+		if !capabilities[s].DeleteAllVersions {
+			return fmt.Sprintf("not allowed to delete %s%s", r.mount, s), nil
+		}
+	}
+	return "", nil
+}
+
+// copyCheckEvent has the keys that exist in the destination mount of a copy,
+// and what the token isn't allowed to do for it
+type copyCheckEvent struct {
+	tcell.EventTime
+	request      copyRequest
+	sources      []string
+	destinations []string
+	existing     []string
+	denied       string
+	err          error
+}
+
+// apply asks before overwriting secrets and before moving, since a move
+// destroys the history of the sources, and then copies
+func (ev *copyCheckEvent) apply(u *Ui) command {
+	u.Busy = ""
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+		return nil
+	}
+	r := ev.request
+	if ev.denied != "" {
+		u.Error = fmt.Sprintf("Failed to %s %s%s, %s", strings.ToLower(r.verb), r.mount, r.source, ev.denied)
+		return nil
+	}
+	overwrite := 0
+	for _, d := range ev.destinations {
+		if slices.Contains(ev.existing, d) {
+			overwrite++
+		}
+	}
+	options := CopyOptions{Metadata: r.metadata, Move: r.move, Overwrite: overwrite > 0}
+	if overwrite == 0 && !r.move {
+		return r.run(u, options)
+	}
+	question := fmt.Sprintf("%s %s%s to %s%s?", r.verb, r.mount, r.source, r.toMount, r.toKey)
+	if overwrite > 0 {
+		question = fmt.Sprintf("%s%s exists, overwrite it?", r.toMount, r.toKey)
+		if r.isDir() {
+			question = fmt.Sprintf("%d of %d secrets exist in %s%s, overwrite them?", overwrite, len(ev.destinations), r.toMount, r.toKey)
+		}
+	}
+	if r.move && r.isDir() {
+		question += fmt.Sprintf(" All versions of the %d secrets in %s%s are destroyed.", len(ev.sources), r.mount, r.source)
+	} else if r.move {
+		question += fmt.Sprintf(" All versions of %s%s are destroyed.", r.mount, r.source)
+	}
+	u.confirm(question, func(u *Ui) command {
+		return r.run(u, options)
+	})
+	return nil
+}
+
+// run copies the secrets
+func (r copyRequest) run(u *Ui, options CopyOptions) command {
+	u.Busy = r.busy
+	return func() tcell.Event {
+		ev := &copyEvent{request: r}
+		if r.isDir() {
+			ev.results, ev.err = r.copier.CopyTree(r.mount, r.source, r.toMount, r.toKey, options)
+		} else {
+			err := r.copier.Copy(r.mount, r.source, r.toMount, r.toKey, options)
+			ev.results = []CopyResult{{From: r.source, To: r.toKey, Err: err}}
+		}
+		return ev
+	}
+}
+
+// copyEvent has the outcome of copying each secret
+type copyEvent struct {
+	tcell.EventTime
+	request copyRequest
+	results []CopyResult
+	err     error
+}
+
+// apply shows how the copy went and reloads the keys, which it has changed
+func (ev *copyEvent) apply(u *Ui) command {
+	u.Busy = ""
+	r := ev.request
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+		return nil
+	}
+	failed := []CopyResult{}
+	for _, result := range ev.results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		u.Error = fmt.Sprintf("Failed to %s %d of %d secrets: %s", strings.ToLower(r.verb), len(failed), len(ev.results), failed[0].Err)
+	} else {
+		u.Message = fmt.Sprintf("%s %s%s to %s%s", r.done, r.mount, r.source, r.toMount, r.toKey)
+	}
+	return u.loadKeys()
+}
+
+// parentDirs are the directories that the key is in, innermost first, like
+// /app/db/ and /app/ for /app/db/password
+func parentDirs(key string) []string {
+	dirs := []string{}
+	for i := strings.LastIndex(key, "/"); i > 0; i = strings.LastIndex(key[:i], "/") {
+		dirs = append(dirs, key[:i+1])
+	}
+	return dirs
+}
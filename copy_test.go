@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/slarwise/pole/vault"
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+func TestCopySecret(t *testing.T) {
+	tests := map[string]struct {
+		action string
+		// dir picks the directory of the selected key instead of the key
+		dir         bool
+		destination string
+		// answer is typed if the user is asked to overwrite or move
+		answer string
+		// deny is a path prefix that the token is not allowed to use
+		deny string
+		// owners are the expected owners in the custom metadata of each
+		// path, the owner of kv/app/db is team
+		owners map[string]string
+		// expected are the values of field name in each path, "" if the
+		// path should not exist
+		expected map[string]string
+		message  string
+		err      string
+	}{
+		"copy": {
+			action: "copy-secret", destination: "secret/new/db",
+			expected: map[string]string{"kv/app/db": "db", "secret/new/db": "db"},
+			message:  "Copied kv/app/db to secret/new/db",
+		},
+		"copy without metadata": {
+			action: "copy-secret", destination: "secret/new/db",
+			expected: map[string]string{"secret/new/db": "db"},
+			owners:   map[string]string{"secret/new/db": ""},
+			message:  "Copied kv/app/db to secret/new/db",
+		},
+		"copy with metadata": {
+			action: "copy-with-metadata", destination: "secret/new/db",
+			expected: map[string]string{"secret/new/db": "db"},
+			owners:   map[string]string{"secret/new/db": "team"},
+			message:  "Copied kv/app/db to secret/new/db",
+		},
+		"copy into a directory": {
+			action: "copy-secret", destination: "secret/new/",
+			expected: map[string]string{"kv/app/db": "db", "secret/new/db": "db"},
+			message:  "Copied kv/app/db to secret/new/db",
+		},
+		"move directory": {
+			action: "move-secret", dir: true, destination: "kv/apps/", answer: "y",
+			expected: map[string]string{"kv/app/db": "", "kv/app/api": "", "kv/apps/db": "db", "kv/apps/api": "api"},
+			message:  "Moved kv/app/ to kv/apps/",
+		},
+		"move declined": {
+			action: "move-secret", destination: "secret/new/db", answer: "n",
+			expected: map[string]string{"kv/app/db": "db", "secret/new/db": ""},
+		},
+		"overwrite declined": {
+			action: "copy-secret", destination: "secret/app/db", answer: "n",
+			expected: map[string]string{"secret/app/db": "old"},
+		},
+		"overwrite confirmed": {
+			action: "move-secret", destination: "secret/app/db", answer: "y",
+			expected: map[string]string{"kv/app/db": "", "secret/app/db": "db"},
+			owners:   map[string]string{"secret/app/db": "team"},
+			message:  "Moved kv/app/db to secret/app/db",
+		},
+		"copy not allowed": {
+			action: "copy-secret", destination: "secret/new/db", deny: "secret/data/new/",
+			expected: map[string]string{"secret/new/db": ""},
+			err:      "Failed to copy kv/app/db, not allowed to create secret/new/db",
+		},
+		"overwrite not allowed": {
+			action: "copy-secret", destination: "secret/app/db", deny: "secret/data/app/db",
+			err: "Failed to copy kv/app/db, not allowed to update secret/app/db",
+		},
+		"move not allowed": {
+			action: "move-secret", dir: true, destination: "kv/apps/", deny: "kv/metadata/app/api",
+			expected: map[string]string{"kv/app/db": "db", "kv/apps/db": ""},
+			err:      "Failed to move kv/app/, not allowed to delete kv/app/api",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := vaulttest.NewServer("test-token")
+			defer server.Close()
+			server.AddMount("kv")
+			server.Put("kv", "/app/db", map[string]interface{}{"name": "db"})
+			server.Put("kv", "/app/api", map[string]interface{}{"name": "api"})
+			server.Put("kv", "/team/readme", map[string]interface{}{"name": "readme"})
+			server.Put("secret", "/app/db", map[string]interface{}{"name": "old"})
+			server.SetCustomMetadata("kv", "/app/db", map[string]string{"owner": "team"})
+			if test.deny != "" {
+				server.Deny(test.deny)
+			}
+			client := vault.NewClient(server.URL, vault.WithToken("test-token"))
+			u := newTestUi(t, kvClient{client: client}, 60, 10)
+
+			events := typeText("app/db")
+			events = append(events, keyEvent(tcell.KeyCtrlSpace))
+			events = append(events, typeText(test.action)...)
+			events = append(events, keyEvent(tcell.KeyEnter))
+			if test.dir {
+				events = append(events, keyEvent(tcell.KeyDown))
+			}
+			events = append(events, keyEvent(tcell.KeyEnter), keyEvent(tcell.KeyCtrlU))
+			events = append(events, typeText(test.destination)...)
+			events = append(events, keyEvent(tcell.KeyEnter))
+			events = append(events, typeText(test.answer)...)
+			run(t, u, events)
+
+			if u.Error != test.err {
+				t.Fatalf("Expected error %q, got %q", test.err, u.Error)
+			}
+			if u.Message != test.message {
+				t.Fatalf("Expected message %q, got %q", test.message, u.Message)
+			}
+			check := vault.NewClient(server.URL, vault.WithToken("test-token"), vault.WithoutCache())
+			for path, expected := range test.expected {
+				mount, name, _ := splitMountPath(path, []string{"kv", "secret"})
+				secret, err := check.GetSecret(context.Background(), mount, name)
+				if expected == "" {
+					if err == nil {
+						t.Fatalf("Expected %s to be gone, got %v", path, secret.Data.Data)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Failed to get %s: %s", path, err)
+				}
+				if secret.Data.Data["name"] != expected {
+					t.Fatalf("Expected %s at %s, got %v", expected, path, secret.Data.Data)
+				}
+			}
+			for path, expected := range test.owners {
+				mount, name, _ := splitMountPath(path, []string{"kv", "secret"})
+				metadata, err := check.GetMetadata(context.Background(), mount, name)
+				if err != nil {
+					t.Fatalf("Failed to get the metadata of %s: %s", path, err)
+				}
+				if metadata.CustomMetadata["owner"] != expected {
+					t.Fatalf("Expected the owner of %s to be %q, got %v", path, expected, metadata.CustomMetadata)
+				}
+			}
+		})
+	}
+}
+
+func TestParentDirs(t *testing.T) {
+	tests := map[string]struct {
+		key      string
+		expected []string
+	}{
+		"nested":    {key: "/app/db/password", expected: []string{"/app/db/", "/app/"}},
+		"top level": {key: "/readme", expected: []string{}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if dirs := parentDirs(test.key); !slices.Equal(dirs, test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, dirs)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+const (
+	DEMO_PROFILE = "demo"
+	DEMO_TOKEN   = "demo-token"
+)
+
+// startDemo starts an in-memory vault with made up secrets, for trying out
+// pole without a vault server, and returns the profile that connects to it.
+// Close the server when done.
+func startDemo() (*vaulttest.Server, Profile) {
+	server := vaulttest.NewServer(DEMO_TOKEN)
+	server.Populate(len(vaulttest.KEYS), 1)
+	return server, Profile{
+		Address:      server.URL,
+		Color:        "green",
+		Token:        tokenConfig{value: DEMO_TOKEN},
+		DefaultMount: vaulttest.DEMO_MOUNTS[0],
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// MASK is shown in place of the values in a diff until they are revealed
+const MASK = "********"
+
+const (
+	CHANGE_ADDED     = "added"
+	CHANGE_REMOVED   = "removed"
+	CHANGE_CHANGED   = "changed"
+	CHANGE_UNCHANGED = "unchanged"
+)
+
+// secretRef points to a secret, or to one version of it
+type secretRef struct {
+	Mount string
+	Key   string
+	// Version is 0 for the latest version
+	Version int
+}
+
+func (r secretRef) String() string {
+	s := r.Mount + r.Key
+	if r.Version > 0 {
+		s += "@" + strconv.Itoa(r.Version)
+	}
+	return s
+}
+
+// parseSecretRef parses a reference like secret/app/db or secret/app/db@3. A
+// reference that is only a version, like @3, is that version of base. Keys
+// may contain @ as long as it isn't followed by only digits.
+func parseSecretRef(s string, mounts []string, base secretRef) (secretRef, error) {
+	ref := secretRef{}
+	path := s
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		if version, err := strconv.Atoi(s[i+1:]); err == nil {
+			if version < 1 {
+				return secretRef{}, fmt.Errorf("Failed to parse %s, versions start at 1", s)
+			}
+			ref.Version = version
+			path = s[:i]
+		}
+	}
+	if path == "" {
+		if base.Mount == "" {
+			return secretRef{}, fmt.Errorf("Failed to parse %s, the first secret must have a path", s)
+		}
+		ref.Mount = base.Mount
+		ref.Key = base.Key
+		return ref, nil
+	}
+	mount, key, err := splitMountPath(path, mounts)
+	if err != nil {
+		return secretRef{}, err
+	}
+	if key == "/" {
+		return secretRef{}, fmt.Errorf("Failed to parse %s, it has no key", s)
+	}
+	ref.Mount = mount
+	ref.Key = key
+	return ref, nil
+}
+
+// splitMountPath splits a path like secret/app/db into its mount and the key
+// in it, /app/db. The mount is the longest of the mounts that the path
+// starts with.
+func splitMountPath(path string, mounts []string) (mount string, key string, err error) {
+	for _, m := range mounts {
+		if strings.HasPrefix(path+"/", m+"/") && len(m) > len(mount) {
+			mount = m
+		}
+	}
+	if mount == "" {
+		return "", "", fmt.Errorf("Failed to find the mount of %s, expected one of %s", path, strings.Join(mounts, ", "))
+	}
+	key = strings.TrimPrefix(path, mount)
+	if key == "" {
+		key = "/"
+	}
+	return mount, key, nil
+}
+
+// getSecretRef gets the secret that ref points to. Earlier versions need a
+// VersionedStore.
+func getSecretRef(store SecretStore, ref secretRef) (Secret, error) {
+	if ref.Version == 0 {
+		return store.GetSecret(ref.Mount, ref.Key)
+	}
+	versioned, ok := store.(VersionedStore)
+	if !ok {
+		return Secret{}, fmt.Errorf("Failed to get %s, the store doesn't keep versions", ref)
+	}
+	return versioned.GetSecretVersion(ref.Mount, ref.Key, ref.Version)
+}
+
+// fieldChange is how one field differs between two secrets
+type fieldChange struct {
+	Field string
+	Kind  string
+	// From is nil for added fields and To is nil for removed fields
+	From interface{}
+	To   interface{}
+}
+
+// secretDiff compares the data of two secrets
+type secretDiff struct {
+	From    secretRef
+	To      secretRef
+	Changes []fieldChange
+}
+
+// diffData compares the fields of two secrets, sorted by name. Unchanged
+// fields are included.
+func diffData(from, to map[string]interface{}) []fieldChange {
+	fields := []string{}
+	for k := range from {
+		fields = append(fields, k)
+	}
+	for k := range to {
+		if _, found := from[k]; !found {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
+	changes := []fieldChange{}
+	for _, field := range fields {
+		f, inFrom := from[field]
+		t, inTo := to[field]
+		change := fieldChange{Field: field, From: f, To: t}
+		switch {
+		case !inFrom:
+			change.Kind = CHANGE_ADDED
+		case !inTo:
+			change.Kind = CHANGE_REMOVED
+		case !reflect.DeepEqual(f, t):
+			change.Kind = CHANGE_CHANGED
+		default:
+			change.Kind = CHANGE_UNCHANGED
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// differs is true if any field has been added, removed or changed
+func (d secretDiff) differs() bool {
+	return slices.ContainsFunc(d.Changes, func(c fieldChange) bool {
+		return c.Kind != CHANGE_UNCHANGED
+	})
+}
+
+// summary counts the changes, like "1 added, 2 changed"
+func (d secretDiff) summary() string {
+	counts := map[string]int{}
+	for _, c := range d.Changes {
+		counts[c.Kind]++
+	}
+	parts := []string{}
+	for _, kind := range []string{CHANGE_ADDED, CHANGE_REMOVED, CHANGE_CHANGED} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	if len(parts) == 0 {
+		return "identical"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// line is the change as one line of text, with a sign in front like in a
+// unified diff and the values masked unless reveal is true
+func (c fieldChange) line(reveal bool) string {
+	switch c.Kind {
+	case CHANGE_ADDED:
+		return fmt.Sprintf("+ %s: %s", c.Field, formatValue(c.To, reveal))
+	case CHANGE_REMOVED:
+		return fmt.Sprintf("- %s: %s", c.Field, formatValue(c.From, reveal))
+	case CHANGE_CHANGED:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Field, formatValue(c.From, reveal), formatValue(c.To, reveal))
+	default:
+		return fmt.Sprintf("  %s: %s", c.Field, formatValue(c.From, reveal))
+	}
+}
+
+// formatValue shows strings as they are and other values as json
+func formatValue(v interface{}, reveal bool) string {
+	if !reveal {
+		return MASK
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes)
+}
+
+// diffSecret lets the user pick what to compare the selected secret with:
+// one of its earlier versions, the same key in another mount or another key
+// in the mount
+func (u *Ui) diffSecret() command {
+	u.Diff = nil
+	key, ok := u.selected()
+	if !ok {
+		return nil
+	}
+	u.Busy = "Loading..."
+	ev := &diffOptionsEvent{from: secretRef{Mount: u.Mounts[u.CurrentMount], Key: key}, descriptions: map[string]string{}}
+	store, mounts := u.Store, slices.Clone(u.Mounts)
+	return func() tcell.Event {
+		from := ev.from
+		if versioned, ok := store.(VersionedStore); ok {
+			versions, err := versioned.GetVersions(from.Mount, from.Key)
+			if err != nil {
+				slog.Error("Failed to get versions", "mount", from.Mount, "key", from.Key, "err", err)
+			}
+			// The last version is the one that is shown
+			for i := len(versions) - 2; i >= 0; i-- {
+				v := versions[i]
+				option := fmt.Sprintf("@%d", v.Version)
+				ev.options = append(ev.options, option)
+				switch {
+				case v.Destroyed:
+					ev.descriptions[option] = "destroyed"
+				case !v.DeletionTime.IsZero():
+					ev.descriptions[option] = "deleted"
+				default:
+					ev.descriptions[option] = "created " + v.CreatedTime.Format(time.DateTime)
+				}
+			}
+		}
+		for _, mount := range mounts {
+			if mount == from.Mount {
+				continue
+			}
+			keys, _, err := store.GetKeys(mount)
+			if err != nil {
+				slog.Error("Failed to get keys", "mount", mount, "err", err)
+				continue
+			}
+			if slices.Contains(keys, from.Key) {
+				option := mount + from.Key
+				ev.options = append(ev.options, option)
+				ev.descriptions[option] = "same key"
+			}
+		}
+		return ev
+	}
+}
+
+// diffOptionsEvent has the secrets that the selected secret can be compared
+// with, other than the keys in the same mount
+type diffOptionsEvent struct {
+	tcell.EventTime
+	from         secretRef
+	options      []string
+	descriptions map[string]string
+}
+
+// apply lets the user pick the secret to compare with
+func (ev *diffOptionsEvent) apply(u *Ui) command {
+	u.Busy = ""
+	if key, ok := u.selected(); !ok || key != ev.from.Key || u.Mounts[u.CurrentMount] != ev.from.Mount {
+		return nil
+	}
+	options := ev.options
+	for _, k := range u.Keys {
+		if k != ev.from.Key {
+			options = append(options, ev.from.Mount+k)
+		}
+	}
+	u.pick("Diff "+ev.from.String()+" with", options, func(option string) string {
+		return ev.descriptions[option]
+	}, func(u *Ui, choice string) command {
+		to, err := parseSecretRef(choice, u.Mounts, ev.from)
+		if err != nil {
+			u.Error = err.Error()
+			return nil
+		}
+		u.Busy = "Loading..."
+		from, store := ev.from, u.Store
+		return func() tcell.Event {
+			fromSecret, err := getSecretRef(store, from)
+			if err != nil {
+				return &diffEvent{err: err}
+			}
+			toSecret, err := getSecretRef(store, to)
+			if err != nil {
+				return &diffEvent{err: err}
+			}
+			return &diffEvent{diff: &secretDiff{From: from, To: to, Changes: diffData(fromSecret.Data, toSecret.Data)}}
+		}
+	})
+	return nil
+}
+
+// diffEvent has the diff of two secrets
+type diffEvent struct {
+	tcell.EventTime
+	diff *secretDiff
+	err  error
+}
+
+func (ev *diffEvent) apply(u *Ui) command {
+	u.Busy = ""
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+		return nil
+	}
+	// The diff is of the selected secret, it is dropped if another one was
+	// selected while it was made
+	if key, ok := u.selected(); !ok || key != ev.diff.From.Key || u.Mounts[u.CurrentMount] != ev.diff.From.Mount {
+		return nil
+	}
+	u.Diff = ev.diff
+	u.RevealDiff = false
+	u.Drift = nil
+	u.ShowReport = false
+	u.ShowDetail = true
+	return nil
+}
+
+// drawDiff shows the fields of the diff, colored by how they changed
+func (u Ui) drawDiff(r rect) {
+	s := clippedScreen{u.Screen, r}
+	x := r.X
+	y := r.Y
+	for _, line := range [][2]string{{"from: ", u.Diff.From.String()}, {"to: ", u.Diff.To.String()}} {
+		drawLine(s, x, y, STYLE_KEY, line[0])
+		drawLine(s, x+textWidth(line[0]), y, STYLE_STRING, line[1])
+		y++
+	}
+	drawLine(s, x, y, STYLE_STATS, u.Diff.summary())
+	y++
+	for _, change := range u.Diff.Changes {
+		style := STYLE_NULL
+		switch change.Kind {
+		case CHANGE_ADDED:
+			style = STYLE_STRING
+		case CHANGE_REMOVED:
+			style = STYLE_ERROR
+		case CHANGE_CHANGED:
+			style = STYLE_STATS
+		}
+		drawLine(s, x, y, style, change.line(u.RevealDiff))
+		y++
+	}
+}
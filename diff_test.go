@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	mounts := []string{"secret", "secret2", "team/kv"}
+	base := secretRef{Mount: "secret", Key: "/app/db"}
+	tests := map[string]struct {
+		ref      string
+		expected secretRef
+		err      bool
+	}{
+		"latest":             {ref: "secret/app/db", expected: secretRef{Mount: "secret", Key: "/app/db"}},
+		"version":            {ref: "secret2/app/db@3", expected: secretRef{Mount: "secret2", Key: "/app/db", Version: 3}},
+		"mount with a slash": {ref: "team/kv/app", expected: secretRef{Mount: "team/kv", Key: "/app"}},
+		"only a version":     {ref: "@2", expected: secretRef{Mount: "secret", Key: "/app/db", Version: 2}},
+		"@ in the key":       {ref: "secret/users/me@example.com", expected: secretRef{Mount: "secret", Key: "/users/me@example.com"}},
+		"version 0":          {ref: "secret/app/db@0", err: true},
+		"unknown mount":      {ref: "nope/app/db", err: true},
+		"no key":             {ref: "secret/", err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ref, err := parseSecretRef(test.ref, mounts, base)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error, got %v", ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if ref != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, ref)
+			}
+		})
+	}
+}
+
+func TestDiffData(t *testing.T) {
+	from := map[string]interface{}{"user": "app", "password": "hunter2", "hosts": []interface{}{"a", "b"}, "old": "x"}
+	to := map[string]interface{}{"user": "app", "password": "hunter3", "hosts": []interface{}{"a", "b"}, "new": "y"}
+	changes := diffData(from, to)
+	lines := []string{}
+	for _, c := range changes {
+		lines = append(lines, c.line(true))
+	}
+	expected := []string{
+		`  hosts: ["a","b"]`,
+		"+ new: y",
+		"- old: x",
+		"~ password: hunter2 -> hunter3",
+		"  user: app",
+	}
+	if !slices.Equal(lines, expected) {
+		t.Fatalf("Expected %q, got %q", expected, lines)
+	}
+	diff := secretDiff{Changes: changes}
+	if !diff.differs() {
+		t.Fatalf("Expected the secrets to differ")
+	}
+	if summary := diff.summary(); summary != "1 added, 1 removed, 1 changed" {
+		t.Fatalf("Expected summary 1 added, 1 removed, 1 changed, got %s", summary)
+	}
+	if line := changes[3].line(false); line != "~ password: ******** -> ********" {
+		t.Fatalf("Expected the values to be masked, got %s", line)
+	}
+	if same := (secretDiff{Changes: diffData(from, from)}); same.differs() || same.summary() != "identical" {
+		t.Fatalf("Expected a secret to be identical to itself, got %s", same.summary())
+	}
+}
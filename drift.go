@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/slarwise/pole/vault"
+)
+
+// ALL_MOUNTS is the option to compare every mount when picking mounts to
+// compare
+const ALL_MOUNTS = "all mounts"
+
+// driftEntry is a path that differs between mounts that should mirror each
+// other
+type driftEntry struct {
+	Path string `json:"path"`
+	// Missing are the mounts that don't have the path
+	Missing []string `json:"missing,omitempty"`
+	// Fields are the fields that only some of the mounts have, with the
+	// mounts that have them
+	Fields map[string][]string `json:"fields,omitempty"`
+	// Shared are the fields that have the same value in more than one mount,
+	// with the groups of mounts that share a value. Only set when values are
+	// compared.
+	Shared map[string][][]string `json:"shared,omitempty"`
+	// Errors are the mounts where the secret could not be read
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// driftReport compares the paths in mounts that mirror each other, e.g. one
+// per environment
+type driftReport struct {
+	Mounts  []string     `json:"mounts"`
+	Entries []driftEntry `json:"entries"`
+}
+
+// findDrift compares the keys in each mount. The secrets at paths that more
+// than one mount has are read with get, at most concurrency at a time, to
+// compare their field names. If compareValues is true, their values are
+// compared by hash to find values that are shared between mounts.
+func findDrift(mounts []string, keys map[string][]string, get func(mount, key string) (Secret, error), compareValues bool, concurrency int) driftReport {
+	paths := []string{}
+	has := make(map[string][]string)
+	for _, mount := range mounts {
+		for _, key := range keys[mount] {
+			if _, found := has[key]; !found {
+				paths = append(paths, key)
+			}
+			has[key] = append(has[key], mount)
+		}
+	}
+	slices.Sort(paths)
+	entries := make([]driftEntry, len(paths))
+	limit := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		entries[i] = driftEntry{Path: path}
+		for _, mount := range mounts {
+			if !slices.Contains(has[path], mount) {
+				entries[i].Missing = append(entries[i].Missing, mount)
+			}
+		}
+		if len(has[path]) < 2 {
+			continue
+		}
+		wg.Add(1)
+		go func(entry *driftEntry, present []string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			compareFields(entry, present, get, compareValues)
+		}(&entries[i], has[path])
+	}
+	wg.Wait()
+	report := driftReport{Mounts: mounts, Entries: []driftEntry{}}
+	for _, entry := range entries {
+		if entry.drifted() {
+			report.Entries = append(report.Entries, entry)
+		}
+	}
+	return report
+}
+
+// compareFields reads the secret at the entry's path in each of the mounts
+// and records the fields that differ
+func compareFields(entry *driftEntry, mounts []string, get func(mount, key string) (Secret, error), compareValues bool) {
+	// hashes are the hashes of the values of each field in each mount, the
+	// values themselves are not kept
+	hashes := make(map[string]map[string][32]byte)
+	read := []string{}
+	for _, mount := range mounts {
+		secret, err := get(mount, entry.Path)
+		if err != nil {
+			if entry.Errors == nil {
+				entry.Errors = make(map[string]string)
+			}
+			entry.Errors[mount] = err.Error()
+			continue
+		}
+		read = append(read, mount)
+		for field, value := range secret.Data {
+			if hashes[field] == nil {
+				hashes[field] = make(map[string][32]byte)
+			}
+			hashes[field][mount] = hashValue(value)
+		}
+	}
+	for field, byMount := range hashes {
+		if len(byMount) < len(read) {
+			if entry.Fields == nil {
+				entry.Fields = make(map[string][]string)
+			}
+			for _, mount := range read {
+				if _, found := byMount[mount]; found {
+					entry.Fields[field] = append(entry.Fields[field], mount)
+				}
+			}
+		}
+		if !compareValues {
+			continue
+		}
+		groups := make(map[[32]byte][]string)
+		order := [][32]byte{}
+		for _, mount := range read {
+			hash, found := byMount[mount]
+			if !found {
+				continue
+			}
+			if _, seen := groups[hash]; !seen {
+				order = append(order, hash)
+			}
+			groups[hash] = append(groups[hash], mount)
+		}
+		for _, hash := range order {
+			if len(groups[hash]) > 1 {
+				if entry.Shared == nil {
+					entry.Shared = make(map[string][][]string)
+				}
+				entry.Shared[field] = append(entry.Shared[field], groups[hash])
+			}
+		}
+	}
+}
+
+// hashValue hashes the value as json, so that values can be compared
+// without holding on to them
+func hashValue(v interface{}) [32]byte {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Failed to marshal value", "err", err)
+	}
+	return sha256.Sum256(bytes)
+}
+
+func (e driftEntry) drifted() bool {
+	return len(e.Missing) > 0 || len(e.Fields) > 0 || len(e.Shared) > 0 || len(e.Errors) > 0
+}
+
+// notes describe how the path differs, one note per line
+func (e driftEntry) notes() []string {
+	notes := []string{}
+	if len(e.Missing) > 0 {
+		notes = append(notes, "missing in "+strings.Join(e.Missing, ", "))
+	}
+	for _, field := range sortedKeys(e.Fields) {
+		notes = append(notes, fmt.Sprintf("field %s only in %s", field, strings.Join(e.Fields[field], ", ")))
+	}
+	for _, field := range sortedKeys(e.Shared) {
+		for _, group := range e.Shared[field] {
+			notes = append(notes, fmt.Sprintf("field %s has the same value in %s", field, strings.Join(group, ", ")))
+		}
+	}
+	for _, mount := range sortedKeys(e.Errors) {
+		notes = append(notes, fmt.Sprintf("failed to read in %s: %s", mount, e.Errors[mount]))
+	}
+	return notes
+}
+
+// writeTable writes the report as a table with a column per mount, that
+// tells if the mount has the path
+func (r driftReport) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PATH\t%s\tDRIFT\n", strings.Join(r.Mounts, "\t"))
+	for _, entry := range r.Entries {
+		columns := []string{entry.Path}
+		for _, mount := range r.Mounts {
+			if slices.Contains(entry.Missing, mount) {
+				columns = append(columns, "-")
+			} else {
+				columns = append(columns, "x")
+			}
+		}
+		notes := entry.notes()
+		fmt.Fprintf(tw, "%s\t%s\n", strings.Join(columns, "\t"), notes[0])
+		for _, note := range notes[1:] {
+			fmt.Fprintf(tw, "%s\t%s\n", strings.Repeat("\t", len(r.Mounts)), note)
+		}
+	}
+	return tw.Flush()
+}
+
+// driftMounts lets the user pick the mounts to compare the current mount
+// with, and shows the paths that differ between them
+func (u *Ui) driftMounts() {
+	if u.Drift != nil {
+		u.Drift = nil
+		return
+	}
+	current := u.Mounts[u.CurrentMount]
+	options := []string{ALL_MOUNTS}
+	for _, mount := range u.Mounts {
+		if mount != current {
+			options = append(options, mount)
+		}
+	}
+	u.pick("Compare "+current+" with", options, nil, func(u *Ui, choice string) command {
+		mounts := []string{current, choice}
+		if choice == ALL_MOUNTS {
+			mounts = slices.Clone(u.Mounts)
+		}
+		u.Busy = "Comparing..."
+		store := u.Store
+		return func() tcell.Event {
+			keys := make(map[string][]string)
+			for _, mount := range mounts {
+				k, _, err := store.GetKeys(mount)
+				if err != nil {
+					return &driftEvent{err: err}
+				}
+				keys[mount] = k
+			}
+			report := findDrift(mounts, keys, store.GetSecret, false, vault.DEFAULT_CONCURRENCY)
+			return &driftEvent{report: &report}
+		}
+	})
+}
+
+// driftEvent has the paths that differ between the mounts
+type driftEvent struct {
+	tcell.EventTime
+	report *driftReport
+	err    error
+}
+
+func (ev *driftEvent) apply(u *Ui) command {
+	u.Busy = ""
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+		return nil
+	}
+	u.Drift = ev.report
+	u.Diff = nil
+	u.ShowReport = false
+	u.ShowDetail = true
+	return nil
+}
+
+// drawDrift lists the paths that differ between the mounts, in place of the
+// secret
+func (u Ui) drawDrift(r rect) {
+	s := clippedScreen{u.Screen, r}
+	x := r.X
+	y := r.Y
+	mounts := strings.Join(u.Drift.Mounts, ", ")
+	if len(u.Drift.Entries) == 0 {
+		drawLine(s, x, y, STYLE_NULL, "No drift between "+mounts)
+		return
+	}
+	drawLine(s, x, y, STYLE_KEY, fmt.Sprintf("%d paths differ between %s:", len(u.Drift.Entries), mounts))
+	y++
+	for _, entry := range u.Drift.Entries {
+		if y >= r.Y+r.Height {
+			break
+		}
+		drawLine(s, x+2, y, STYLE_STRING, entry.Path)
+		y++
+		for _, note := range entry.notes() {
+			drawLine(s, x+4, y, STYLE_STATS, note)
+			y++
+		}
+	}
+}
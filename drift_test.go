@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindDrift(t *testing.T) {
+	data := map[string]map[string]interface{}{
+		"dev/app/db":     {"user": "app", "password": "dev"},
+		"staging/app/db": {"user": "app", "password": "staging", "port": "5432"},
+		"prod/app/db":    {"user": "app", "password": "dev"},
+		"dev/app/api":    {"key": "a"},
+		"prod/app/api":   {"key": "b"},
+		"dev/only/dev":   {"x": "y"},
+	}
+	keys := map[string][]string{
+		"dev":     {"/app/db", "/app/api", "/only/dev"},
+		"staging": {"/app/db", "/app/broken"},
+		"prod":    {"/app/db", "/app/api", "/app/broken"},
+	}
+	get := func(mount, key string) (Secret, error) {
+		d, found := data[mount+key]
+		if !found {
+			return Secret{}, fmt.Errorf("permission denied")
+		}
+		return Secret{Data: d}, nil
+	}
+	tests := map[string]struct {
+		compareValues bool
+		expected      []driftEntry
+	}{
+		"fields": {
+			expected: []driftEntry{
+				{Path: "/app/api", Missing: []string{"staging"}},
+				{Path: "/app/broken", Missing: []string{"dev"}, Errors: map[string]string{"staging": "permission denied", "prod": "permission denied"}},
+				{Path: "/app/db", Fields: map[string][]string{"port": {"staging"}}},
+				{Path: "/only/dev", Missing: []string{"staging", "prod"}},
+			},
+		},
+		"values": {
+			compareValues: true,
+			expected: []driftEntry{
+				{Path: "/app/api", Missing: []string{"staging"}},
+				{Path: "/app/broken", Missing: []string{"dev"}, Errors: map[string]string{"staging": "permission denied", "prod": "permission denied"}},
+				{Path: "/app/db", Fields: map[string][]string{"port": {"staging"}}, Shared: map[string][][]string{"password": {{"dev", "prod"}}, "user": {{"dev", "staging", "prod"}}}},
+				{Path: "/only/dev", Missing: []string{"staging", "prod"}},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := findDrift([]string{"dev", "staging", "prod"}, keys, get, test.compareValues, 2)
+			if !reflect.DeepEqual(report.Entries, test.expected) {
+				t.Fatalf("Expected %+v, got %+v", test.expected, report.Entries)
+			}
+		})
+	}
+}
+
+func TestDriftTable(t *testing.T) {
+	report := driftReport{
+		Mounts: []string{"dev", "prod"},
+		Entries: []driftEntry{
+			{Path: "/app/db", Fields: map[string][]string{"port": {"dev"}, "tls": {"prod"}}},
+			{Path: "/only/dev", Missing: []string{"prod"}},
+		},
+	}
+	var b strings.Builder
+	if err := report.writeTable(&b); err != nil {
+		t.Fatalf("Failed to write table: %s", err)
+	}
+	expected := `PATH       dev  prod  DRIFT
+/app/db    x    x     field port only in dev
+                      field tls only in prod
+/only/dev  x    -     missing in prod
+`
+	if b.String() != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
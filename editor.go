@@ -0,0 +1,93 @@
+package main
+
+import "unicode"
+
+// lineEditor is a line of text with a cursor, edited like in readline.
+// Cursor is an index into Text, between 0 and len(Text).
+type lineEditor struct {
+	Text   []rune
+	Cursor int
+}
+
+func (e lineEditor) String() string {
+	return string(e.Text)
+}
+
+// set replaces the text and puts the cursor at the end
+func (e *lineEditor) set(text string) {
+	e.Text = []rune(text)
+	e.Cursor = len(e.Text)
+}
+
+func (e *lineEditor) insert(text string) {
+	runes := []rune(text)
+	e.Text = append(e.Text[:e.Cursor], append(runes, e.Text[e.Cursor:]...)...)
+	e.Cursor += len(runes)
+}
+
+// deleteBack deletes the character before the cursor
+func (e *lineEditor) deleteBack() {
+	if e.Cursor == 0 {
+		return
+	}
+	e.Text = append(e.Text[:e.Cursor-1], e.Text[e.Cursor:]...)
+	e.Cursor--
+}
+
+// deleteWordBack deletes from the beginning of the word before the cursor to
+// the cursor
+func (e *lineEditor) deleteWordBack() {
+	start := e.wordStart()
+	e.Text = append(e.Text[:start], e.Text[e.Cursor:]...)
+	e.Cursor = start
+}
+
+func (e *lineEditor) left() {
+	e.Cursor = max(e.Cursor-1, 0)
+}
+
+func (e *lineEditor) right() {
+	e.Cursor = min(e.Cursor+1, len(e.Text))
+}
+
+func (e *lineEditor) home() {
+	e.Cursor = 0
+}
+
+func (e *lineEditor) end() {
+	e.Cursor = len(e.Text)
+}
+
+func (e *lineEditor) wordLeft() {
+	e.Cursor = e.wordStart()
+}
+
+// wordRight moves the cursor to the end of the current or next word
+func (e *lineEditor) wordRight() {
+	i := e.Cursor
+	for i < len(e.Text) && !isWordChar(e.Text[i]) {
+		i++
+	}
+	for i < len(e.Text) && isWordChar(e.Text[i]) {
+		i++
+	}
+	e.Cursor = i
+}
+
+// wordStart is the beginning of the current or previous word
+func (e lineEditor) wordStart() int {
+	i := e.Cursor
+	for i > 0 && !isWordChar(e.Text[i-1]) {
+		i--
+	}
+	for i > 0 && isWordChar(e.Text[i-1]) {
+		i--
+	}
+	return i
+}
+
+// isWordChar is true for letters and digits, so that the parts of a path are
+// words of their own
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
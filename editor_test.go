@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestLineEditor(t *testing.T) {
+	tests := map[string]struct {
+		text   string
+		cursor int
+		edit   func(e *lineEditor)
+		result string
+		after  int
+	}{
+		"insert-at-end":               {text: "sec", cursor: 3, edit: func(e *lineEditor) { e.insert("ret") }, result: "secret", after: 6},
+		"insert-in-middle":            {text: "scret", cursor: 1, edit: func(e *lineEditor) { e.insert("e") }, result: "secret", after: 2},
+		"delete-back":                 {text: "secret", cursor: 2, edit: (*lineEditor).deleteBack, result: "scret", after: 1},
+		"delete-back-at-start":        {text: "secret", cursor: 0, edit: (*lineEditor).deleteBack, result: "secret", after: 0},
+		"delete-word":                 {text: "db/prod/pass", cursor: 12, edit: (*lineEditor).deleteWordBack, result: "db/prod/", after: 8},
+		"delete-word-after-separator": {text: "db/prod/", cursor: 8, edit: (*lineEditor).deleteWordBack, result: "db/", after: 3},
+		"word-left":                   {text: "db/prod", cursor: 5, edit: (*lineEditor).wordLeft, result: "db/prod", after: 3},
+		"word-right":                  {text: "db/prod", cursor: 1, edit: (*lineEditor).wordRight, result: "db/prod", after: 2},
+		"word-right-skips-separator":  {text: "db/prod", cursor: 2, edit: (*lineEditor).wordRight, result: "db/prod", after: 7},
+		"left-at-start":               {text: "db", cursor: 0, edit: (*lineEditor).left, result: "db", after: 0},
+		"right-at-end":                {text: "db", cursor: 2, edit: (*lineEditor).right, result: "db", after: 2},
+		"home":                        {text: "db", cursor: 1, edit: (*lineEditor).home, result: "db", after: 0},
+		"end":                         {text: "db", cursor: 1, edit: (*lineEditor).end, result: "db", after: 2},
+		"multibyte":                   {text: "åäö", cursor: 3, edit: (*lineEditor).deleteBack, result: "åä", after: 2},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := lineEditor{Text: []rune(test.text), Cursor: test.cursor}
+			test.edit(&e)
+			if e.String() != test.result {
+				t.Fatalf("Expected text %q, got %q", test.result, e.String())
+			}
+			if e.Cursor != test.after {
+				t.Fatalf("Expected cursor at %d, got %d", test.after, e.Cursor)
+			}
+		})
+	}
+}
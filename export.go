@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slarwise/pole/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// The formats that secrets can be exported to and imported from. Files is a
+// directory with a json file per secret.
+const (
+	FORMAT_JSON  = "json"
+	FORMAT_YAML  = "yaml"
+	FORMAT_FILES = "files"
+)
+
+var EXPORT_FORMATS = []string{FORMAT_JSON, FORMAT_YAML, FORMAT_FILES}
+
+type exportOptions struct {
+	// Versions exports all versions instead of only the latest
+	Versions bool
+	// Metadata exports the metadata of the secrets
+	Metadata bool
+	// Concurrency is the max number of secrets that are read at once, and
+	// held in memory while waiting to be written
+	Concurrency int
+}
+
+// exportedSecret is what is exported of a secret when its versions or
+// metadata are included. Otherwise only the data of the latest version is
+// exported.
+type exportedSecret struct {
+	// Data is the data of the latest version, nil if it is deleted
+	Data     map[string]interface{} `json:"data" yaml:"data,omitempty"`
+	Metadata *exportedMetadata      `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Versions []exportedVersion      `json:"versions,omitempty" yaml:"versions,omitempty"`
+}
+
+type exportedMetadata struct {
+	CurrentVersion int               `json:"current_version" yaml:"current_version"`
+	CreatedTime    time.Time         `json:"created_time" yaml:"created_time"`
+	UpdatedTime    time.Time         `json:"updated_time" yaml:"updated_time"`
+	CustomMetadata map[string]string `json:"custom_metadata,omitempty" yaml:"custom_metadata,omitempty"`
+}
+
+type exportedVersion struct {
+	Version     int       `json:"version" yaml:"version"`
+	CreatedTime time.Time `json:"created_time" yaml:"created_time"`
+	Deleted     bool      `json:"deleted,omitempty" yaml:"deleted,omitempty"`
+	Destroyed   bool      `json:"destroyed,omitempty" yaml:"destroyed,omitempty"`
+	// Data is nil for deleted and destroyed versions
+	Data map[string]interface{} `json:"data" yaml:"data,omitempty"`
+}
+
+// exported is a secret that has been read for exporting
+type exported struct {
+	Key   string
+	Value interface{}
+	Err   error
+}
+
+// exportSecret reads what is exported of the secret at key
+func exportSecret(ctx context.Context, client vault.Client, mount, key string, options exportOptions) (interface{}, error) {
+	secret, err := client.GetSecret(ctx, mount, key)
+	if err != nil {
+		return nil, err
+	}
+	if !options.Versions && !options.Metadata {
+		if secret.Data.Data == nil {
+			// Untyped, so that yaml writes null like json instead of {}
+			return nil, nil
+		}
+		return secret.Data.Data, nil
+	}
+	result := exportedSecret{Data: secret.Data.Data}
+	metadata, err := client.GetMetadata(ctx, mount, key)
+	if err != nil {
+		return nil, err
+	}
+	if options.Metadata {
+		result.Metadata = &exportedMetadata{
+			CurrentVersion: metadata.CurrentVersion,
+			CreatedTime:    metadata.CreatedTime,
+			UpdatedTime:    metadata.UpdatedTime,
+			CustomMetadata: metadata.CustomMetadata,
+		}
+	}
+	if options.Versions {
+		for _, v := range metadata.Versions {
+			version := exportedVersion{
+				Version:     v.Version,
+				CreatedTime: v.CreatedTime,
+				Deleted:     !v.DeletionTime.IsZero(),
+				Destroyed:   v.Destroyed,
+			}
+			if !version.Deleted && !version.Destroyed {
+				s, err := client.GetSecretVersion(ctx, mount, key, v.Version)
+				if err != nil {
+					return nil, err
+				}
+				version.Data = s.Data.Data
+			}
+			result.Versions = append(result.Versions, version)
+		}
+	}
+	return result, nil
+}
+
+// streamExport reads the secrets at keys, at most options.Concurrency at a
+// time, and writes them in the order of keys. A secret that has been read
+// waits for the ones before it to be written, so no more than Concurrency
+// secrets are held at once.
+func streamExport(ctx context.Context, client vault.Client, mount string, keys []string, options exportOptions, write func(exported) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := max(options.Concurrency, 1)
+	limit := make(chan struct{}, concurrency)
+	// pending has a channel for each secret that is being read, in the
+	// order that they are written
+	pending := make(chan chan exported, concurrency)
+	go func() {
+		defer close(pending)
+		for _, key := range keys {
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			result := make(chan exported, 1)
+			pending <- result
+			go func(key string) {
+				value, err := exportSecret(ctx, client, mount, key, options)
+				result <- exported{Key: key, Value: value, Err: err}
+			}(key)
+		}
+	}()
+	for result := range pending {
+		err := write(<-result)
+		<-limit
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// exportWriter writes the exported secrets in one of the formats
+type exportWriter interface {
+	write(key string, value interface{}) error
+	close() error
+}
+
+// jsonExport writes an object with the keys as properties, one at a time
+type jsonExport struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExport) write(key string, value interface{}) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s: %s", key, err)
+	}
+	separator := "{\n"
+	if e.count > 0 {
+		separator = ",\n"
+	}
+	e.count++
+	_, err = fmt.Fprintf(e.w, "%s  %s: %s", separator, k, v)
+	return err
+}
+
+func (e *jsonExport) close() error {
+	end := "\n}\n"
+	if e.count == 0 {
+		end = "{}\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// yamlExport writes a mapping with the keys, one at a time. Mappings with
+// one key each, one after the other, make up one larger mapping.
+type yamlExport struct {
+	w     io.Writer
+	count int
+}
+
+func (e *yamlExport) write(key string, value interface{}) error {
+	bytes, err := yaml.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s: %s", key, err)
+	}
+	e.count++
+	_, err = e.w.Write(bytes)
+	return err
+}
+
+func (e *yamlExport) close() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "{}\n")
+		return err
+	}
+	return nil
+}
+
+// filesExport writes each secret to a json file in dir, at the path of its
+// key, like dir/app/db.json for /app/db. The files can only be read by the
+// user.
+type filesExport struct {
+	dir string
+}
+
+func (e filesExport) write(key string, value interface{}) error {
+	path := filepath.Join(e.dir, filepath.FromSlash(key)+".json")
+	if rel, err := filepath.Rel(e.dir, path); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("Failed to write %s, its path is outside of %s", key, e.dir)
+	}
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s: %s", key, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("Failed to create directory for %s: %s", key, err)
+	}
+	if err := os.WriteFile(path, append(bytes, '\n'), 0o600); err != nil {
+		return fmt.Errorf("Failed to write %s: %s", key, err)
+	}
+	return nil
+}
+
+func (e filesExport) close() error {
+	return nil
+}
+
+// keysBelow are the keys that are prefix or below it, all keys if prefix is /
+func keysBelow(keys []string, prefix string) []string {
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	below := []string{}
+	for _, key := range keys {
+		if key == prefix || strings.HasPrefix(key, dir) {
+			below = append(below, key)
+		}
+	}
+	slices.Sort(below)
+	return below
+}
+
+func exportCommand(ctx context.Context, vaultClient vault.Client, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", FORMAT_JSON, "one of "+strings.Join(EXPORT_FORMATS, ", "))
+	output := flags.String("o", "", "`path` of the file to write to, or the directory for files. Stdout if empty.")
+	versions := flags.Bool("versions", false, "export all versions instead of only the latest")
+	metadata := flags.Bool("metadata", false, "export the metadata of the secrets")
+	concurrency := flags.Int("concurrency", vault.DEFAULT_CONCURRENCY, "max number of secrets to read at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: pole export [-format format] [-o path] [-versions] [-metadata] <mount>[/<prefix>]")
+	}
+	if !slices.Contains(EXPORT_FORMATS, *format) {
+		return fmt.Errorf("Unknown format %s, expected one of %s", *format, strings.Join(EXPORT_FORMATS, ", "))
+	}
+	if *format == FORMAT_FILES && *output == "" {
+		return fmt.Errorf("The files format needs a directory to write to, set it with -o")
+	}
+	mounts, err := vaultClient.GetMounts(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get mounts: %s", err)
+	}
+	mount, prefix, err := splitMountPath(strings.TrimSuffix(flags.Arg(0), "/"), mounts)
+	if err != nil {
+		return err
+	}
+	// Every secret is read once, caching them would only keep all of them in
+	// memory until pole exits
+	vaultClient = vaultClient.With(vault.WithoutCache(), vault.WithConcurrency(*concurrency))
+	allKeys, report, err := vaultClient.GetKeys(ctx, mount)
+	if err != nil {
+		return err
+	}
+	if len(report) > 0 {
+		fmt.Fprint(os.Stderr, report)
+	}
+	keys := keysBelow(allKeys, prefix)
+	var writer exportWriter
+	switch *format {
+	case FORMAT_FILES:
+		writer = filesExport{dir: *output}
+	default:
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return fmt.Errorf("Failed to open %s: %s", *output, err)
+			}
+			defer file.Close()
+			w = file
+		}
+		if *format == FORMAT_YAML {
+			writer = &yamlExport{w: w}
+		} else {
+			writer = &jsonExport{w: w}
+		}
+	}
+	options := exportOptions{Versions: *versions, Metadata: *metadata, Concurrency: *concurrency}
+	failed := 0
+	err = streamExport(ctx, vaultClient, mount, keys, options, func(e exported) error {
+		if e.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Failed to export %s: %s\n", e.Key, e.Err)
+			return nil
+		}
+		return writer.write(e.Key, e.Value)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to export %s: %s", flags.Arg(0), err)
+	}
+	if err := writer.close(); err != nil {
+		return fmt.Errorf("Failed to export %s: %s", flags.Arg(0), err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to export %d of %d secrets", failed, len(keys))
+	}
+	return nil
+}
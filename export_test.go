@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slarwise/pole/vault"
+	"github.com/slarwise/pole/vault/vaulttest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStreamExport(t *testing.T) {
+	server := vaulttest.NewServer(SYNC_TOKEN)
+	defer server.Close()
+	keys := []string{}
+	for _, key := range []string{"/a", "/b", "/c/d", "/c/e", "/f"} {
+		server.Put("secret", key, map[string]interface{}{"key": key})
+		keys = append(keys, key)
+	}
+	server.Put("secret", "/b", map[string]interface{}{"key": "/b", "version": "2"})
+	server.SetCustomMetadata("secret", "/b", map[string]string{"owner": "team"})
+	server.Deny("secret/data/c/d")
+	server.SetLatency(time.Millisecond)
+	client := vault.NewClient(server.URL, vault.WithToken(SYNC_TOKEN))
+
+	written := []string{}
+	failed := []string{}
+	values := map[string]interface{}{}
+	options := exportOptions{Versions: true, Metadata: true, Concurrency: 2}
+	err := streamExport(context.Background(), client, "secret", keys, options, func(e exported) error {
+		written = append(written, e.Key)
+		if e.Err != nil {
+			failed = append(failed, e.Key)
+		}
+		values[e.Key] = e.Value
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(written, keys) {
+		t.Fatalf("Expected the secrets to be written in the order %v, got %v", keys, written)
+	}
+	if !reflect.DeepEqual(failed, []string{"/c/d"}) {
+		t.Fatalf("Expected only /c/d to fail, got %v", failed)
+	}
+	b := values["/b"].(exportedSecret)
+	if len(b.Versions) != 2 || b.Versions[0].Data["version"] != nil || b.Versions[1].Data["version"] != "2" {
+		t.Fatalf("Expected both versions of /b, got %+v", b.Versions)
+	}
+	if b.Metadata == nil || b.Metadata.CurrentVersion != 2 || b.Metadata.CustomMetadata["owner"] != "team" {
+		t.Fatalf("Expected the metadata of /b, got %+v", b.Metadata)
+	}
+}
+
+func TestExportIsNotCached(t *testing.T) {
+	server := vaulttest.NewServer(SYNC_TOKEN)
+	defer server.Close()
+	server.Put("secret", "/a", map[string]interface{}{"a": "exported"})
+	client := vault.NewClient(server.URL, vault.WithToken(SYNC_TOKEN))
+	output := filepath.Join(t.TempDir(), "export.json")
+	if err := exportCommand(context.Background(), client, []string{"-o", output, "secret"}); err != nil {
+		t.Fatalf("Failed to export: %s", err)
+	}
+	// The copies of a client share its cache, so the secret would still be
+	// the exported one if the export had cached it
+	server.Put("secret", "/a", map[string]interface{}{"a": "changed"})
+	secret, err := client.GetSecret(context.Background(), "secret", "/a")
+	if err != nil {
+		t.Fatalf("Failed to get /a: %s", err)
+	}
+	if secret.Data.Data["a"] != "changed" {
+		t.Fatalf("Expected the export to leave the cache empty, got %v", secret.Data.Data["a"])
+	}
+}
+
+func TestExportWriters(t *testing.T) {
+	secrets := []exported{
+		{Key: "/app/db", Value: map[string]interface{}{"password": "hunter2"}},
+		{Key: "/app/api", Value: map[string]interface{}{"token": "abc", "enabled": true}},
+		{Key: "/deleted", Value: nil},
+	}
+	expected := map[string]interface{}{}
+	for _, s := range secrets {
+		expected[s.Key] = s.Value
+	}
+	tests := map[string]struct {
+		writer    func(w *bytes.Buffer) exportWriter
+		unmarshal func([]byte, any) error
+	}{
+		"json": {
+			writer:    func(w *bytes.Buffer) exportWriter { return &jsonExport{w: w} },
+			unmarshal: json.Unmarshal,
+		},
+		"yaml": {
+			writer:    func(w *bytes.Buffer) exportWriter { return &yamlExport{w: w} },
+			unmarshal: yaml.Unmarshal,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, count := range []int{0, len(secrets)} {
+				var buf bytes.Buffer
+				writer := test.writer(&buf)
+				for _, s := range secrets[:count] {
+					if err := writer.write(s.Key, s.Value); err != nil {
+						t.Fatalf("Expected no error, got %s", err)
+					}
+				}
+				if err := writer.close(); err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+				got := map[string]interface{}{}
+				if err := test.unmarshal(buf.Bytes(), &got); err != nil {
+					t.Fatalf("Expected valid output, got %s: %s", err, buf.String())
+				}
+				if count == 0 {
+					if len(got) != 0 {
+						t.Fatalf("Expected an empty export, got %v", got)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Fatalf("Expected %v, got %v", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilesExport(t *testing.T) {
+	dir := t.TempDir()
+	writer := filesExport{dir: dir}
+	if err := writer.write("/app/db", map[string]interface{}{"password": "hunter2"}); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	path := filepath.Join(dir, "app", "db.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected %s to be written, got %s", path, err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected %s to only be readable by the user, got %s", path, info.Mode())
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), `"password": "hunter2"`) {
+		t.Fatalf("Expected the data in %s, got %s", path, content)
+	}
+	if err := writer.write("/../outside", map[string]interface{}{}); err == nil {
+		t.Fatalf("Expected an error when writing outside of the directory")
+	}
+}
+
+func TestKeysBelow(t *testing.T) {
+	keys := []string{"/b", "/app/db", "/app", "/apps/x", "/app/api"}
+	tests := map[string]struct {
+		prefix   string
+		expected []string
+	}{
+		"all":       {prefix: "/", expected: []string{"/app", "/app/api", "/app/db", "/apps/x", "/b"}},
+		"directory": {prefix: "/app", expected: []string{"/app", "/app/api", "/app/db"}},
+		"slash":     {prefix: "/app/", expected: []string{"/app/api", "/app/db"}},
+		"secret":    {prefix: "/b", expected: []string{"/b"}},
+		"none":      {prefix: "/c", expected: []string{}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := keysBelow(keys, test.prefix)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// actionNames are the names of all actions, sorted
+func actionNames() []string {
+	names := []string{}
+	for name := range ACTIONS {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// dialog is drawn instead of the keys and gets the key presses until it
+// closes by setting u.Dialog to nil. Like the rest of the ui, handleKey is
+// called by update and draw by Redraw.
+type dialog interface {
+	handleKey(u *Ui, ev *tcell.EventKey) command
+	draw(u Ui)
+}
+
+// helpDialog lists every action with its keys until a key that doesn't
+// scroll is pressed
+type helpDialog struct {
+	names []string
+	start int
+}
+
+func (u *Ui) showHelpOverlay() {
+	u.Dialog = &helpDialog{names: actionNames()}
+}
+
+func (d *helpDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	switch ev.Key() {
+	case tcell.KeyCtrlK, tcell.KeyCtrlP, tcell.KeyUp:
+		d.start = max(d.start-1, 0)
+	case tcell.KeyCtrlJ, tcell.KeyCtrlN, tcell.KeyDown:
+		d.start = min(d.start+1, max(len(d.names)-u.helpRows(), 0))
+	default:
+		u.Dialog = nil
+	}
+	return nil
+}
+
+// helpRows is the number of actions that fit in the help overlay
+func (u Ui) helpRows() int {
+	return max(u.Height-4, 1)
+}
+
+func (d *helpDialog) draw(u Ui) {
+	names, start := d.names, d.start
+	u.Screen.HideCursor()
+	x := 2
+	y := 1
+	drawLine(u.Screen, x, y, tcell.StyleDefault.Bold(true), "Actions")
+	y += 2
+	nameWidth := 0
+	keysWidth := 0
+	for _, name := range names {
+		nameWidth = max(nameWidth, textWidth(name))
+		keysWidth = max(keysWidth, textWidth(strings.Join(u.Keymap.keysOf(name), ", ")))
+	}
+	end := min(start+u.helpRows(), len(names))
+	for _, name := range names[start:end] {
+		drawLine(u.Screen, x, y, STYLE_KEY, name)
+		keys := strings.Join(u.Keymap.keysOf(name), ", ")
+		if keys == "" {
+			drawLine(u.Screen, x+nameWidth+2, y, STYLE_NULL, "unbound")
+		} else {
+			drawLine(u.Screen, x+nameWidth+2, y, STYLE_STRING, keys)
+		}
+		drawLine(u.Screen, x+nameWidth+keysWidth+4, y, STYLE_DEFAULT, ACTIONS[name].Description)
+		y++
+	}
+	helpStr := "Scroll ↑↓ Close <any key>"
+	if end < len(names) || start > 0 {
+		helpStr = fmt.Sprintf("%d-%d of %d  %s", start+1, end, len(names), helpStr)
+	}
+	drawLine(u.Screen, x, u.Height-1, STYLE_HELP, helpStr)
+}
+
+// commandPalette lets the user search for an action by name and runs it
+func (u *Ui) commandPalette() {
+	u.pick("Run action", actionNames(), func(name string) string {
+		description := ACTIONS[name].Description
+		if keys := u.Keymap.keysOf(name); len(keys) > 0 {
+			description = fmt.Sprintf("%s (%s)", description, keys[0])
+		}
+		return description
+	}, func(u *Ui, name string) command {
+		if name == "command-palette" {
+			return nil
+		}
+		return ACTIONS[name].Run(u)
+	})
+}
+
+// switchMount lets the user pick the mount to show the keys in
+func (u *Ui) switchMount() {
+	u.pick("Switch mount", u.Mounts, nil, func(u *Ui, mount string) command {
+		return u.showMount(slices.Index(u.Mounts, mount))
+	})
+}
+
+// pickDialog lets the user fuzzy search among the options and choose one of
+// them. describe, if not nil, gives a description that is shown next to each
+// option. onPick is called with the choice, nothing is called if the user
+// cancels.
+type pickDialog struct {
+	title    string
+	options  []string
+	describe func(string) string
+	onPick   func(u *Ui, choice string) command
+	query    string
+	selected int
+}
+
+func (u *Ui) pick(title string, options []string, describe func(string) string, onPick func(u *Ui, choice string) command) {
+	u.Dialog = &pickDialog{title: title, options: options, describe: describe, onPick: onPick}
+}
+
+// matches are the options that match the query, best first
+func (d *pickDialog) matches() []Match {
+	matches := []Match{}
+	for _, o := range d.options {
+		if match, consecutive := matchesPrompt(d.query, o); match {
+			matches = append(matches, Match{Key: o, ConsecutiveMatches: consecutive})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return b.ConsecutiveMatches - a.ConsecutiveMatches
+	})
+	return matches
+}
+
+func (d *pickDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	matches := d.matches()
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		u.Dialog = nil
+	case tcell.KeyEnter:
+		if len(matches) > 0 {
+			u.Dialog = nil
+			return d.onPick(u, matches[d.selected].Key)
+		}
+	case tcell.KeyCtrlK, tcell.KeyCtrlP, tcell.KeyUp:
+		d.selected = max(d.selected-1, 0)
+	case tcell.KeyCtrlJ, tcell.KeyCtrlN, tcell.KeyDown:
+		d.selected = min(d.selected+1, len(matches)-1)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(d.query) > 0 {
+			_, size := utf8.DecodeLastRuneInString(d.query)
+			d.query = d.query[:len(d.query)-size]
+			d.selected = 0
+		}
+	case tcell.KeyCtrlU:
+		d.query = ""
+		d.selected = 0
+	case tcell.KeyRune:
+		d.query += string(ev.Rune())
+		d.selected = 0
+	}
+	d.selected = max(min(d.selected, len(d.matches())-1), 0)
+	return nil
+}
+
+func (d *pickDialog) draw(u Ui) {
+	matches, selected := d.matches(), d.selected
+	x := 2
+	y := 1
+	drawLine(u.Screen, x, y, tcell.StyleDefault.Bold(true), d.title)
+	y += 2
+	width := 0
+	for _, m := range matches {
+		width = max(width, textWidth(m.Key))
+	}
+	rows := max(u.Height-5, 1)
+	start := max(selected-rows+1, 0)
+	for i := start; i < min(start+rows, len(matches)); i++ {
+		style := STYLE_DEFAULT
+		if i == selected {
+			drawLine(u.Screen, x, y, STYLE_CURSOR, " ")
+			style = STYLE_SELECTED
+		}
+		drawLine(u.Screen, x+2, y, style, matches[i].Key)
+		if d.describe != nil {
+			drawLine(u.Screen, x+width+4, y, STYLE_NULL, d.describe(matches[i].Key))
+		}
+		y++
+	}
+	if len(matches) == 0 {
+		drawLine(u.Screen, x+2, y, STYLE_NULL, "No matches")
+	}
+	drawLine(u.Screen, x, u.Height-2, STYLE_HELP, "Move ↑↓ Choose <Enter> Cancel <Esc>")
+	drawLine(u.Screen, 0, u.Height-1, tcell.StyleDefault.Bold(true), ":")
+	drawLine(u.Screen, 2, u.Height-1, STYLE_DEFAULT, d.query)
+	u.Screen.ShowCursor(2+textWidth(d.query), u.Height-1)
+}
+
+// inputDialog lets the user edit a line of text, onDone is called with the
+// text unless the user cancels
+type inputDialog struct {
+	title  string
+	editor lineEditor
+	onDone func(u *Ui, text string) command
+}
+
+func (u *Ui) input(title, initial string, onDone func(u *Ui, text string) command) {
+	d := &inputDialog{title: title, onDone: onDone}
+	d.editor.set(initial)
+	u.Dialog = d
+}
+
+func (d *inputDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		u.Dialog = nil
+	case tcell.KeyEnter:
+		u.Dialog = nil
+		return d.onDone(u, d.editor.String())
+	case tcell.KeyLeft, tcell.KeyCtrlB:
+		d.editor.left()
+	case tcell.KeyRight, tcell.KeyCtrlF:
+		d.editor.right()
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		d.editor.home()
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		d.editor.end()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		d.editor.deleteBack()
+	case tcell.KeyCtrlW:
+		d.editor.deleteWordBack()
+	case tcell.KeyCtrlU:
+		d.editor.set("")
+	case tcell.KeyRune:
+		d.editor.insert(string(ev.Rune()))
+	}
+	return nil
+}
+
+func (d *inputDialog) draw(u Ui) {
+	drawLine(u.Screen, 2, 1, tcell.StyleDefault.Bold(true), d.title)
+	drawLine(u.Screen, 2, u.Height-2, STYLE_HELP, "Done <Enter> Cancel <Esc>")
+	drawLine(u.Screen, 0, u.Height-1, tcell.StyleDefault.Bold(true), ":")
+	drawLine(u.Screen, 2, u.Height-1, STYLE_DEFAULT, d.editor.String())
+	u.Screen.ShowCursor(2+textWidth(string(d.editor.Text[:d.editor.Cursor])), u.Height-1)
+}
+
+// confirmDialog asks a yes or no question, anything but y is a no. onYes is
+// called if the answer is yes.
+type confirmDialog struct {
+	question string
+	onYes    func(u *Ui) command
+}
+
+func (u *Ui) confirm(question string, onYes func(u *Ui) command) {
+	u.Dialog = &confirmDialog{question: question, onYes: onYes}
+}
+
+func (d *confirmDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	u.Dialog = nil
+	if ev.Key() == tcell.KeyRune && ev.Rune() == 'y' {
+		return d.onYes(u)
+	}
+	return nil
+}
+
+func (d *confirmDialog) draw(u Ui) {
+	drawLine(u.Screen, 2, 1, tcell.StyleDefault.Bold(true), d.question)
+	drawLine(u.Screen, 2, u.Height-2, STYLE_HELP, "Yes <y> No <n>")
+	u.Screen.HideCursor()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestPickDialogBackspace(t *testing.T) {
+	d := &pickDialog{options: []string{"secret", "hemlighet", "secreto"}}
+	u := &Ui{Dialog: d}
+	for _, r := range "sé€" {
+		d.handleKey(u, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	d.handleKey(u, tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone))
+	if d.query != "sé" {
+		t.Fatalf("Expected backspace to delete the last rune, got %q", d.query)
+	}
+	d.handleKey(u, tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone))
+	if d.query != "s" {
+		t.Fatalf("Expected backspace to delete the last rune, got %q", d.query)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HISTORY_SIZE is the number of queries that are kept in the history
+const HISTORY_SIZE = 1000
+
+// historyPath is $XDG_STATE_HOME/pole/history, or
+// ~/.local/state/pole/history if XDG_STATE_HOME is not set
+func historyPath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = expandHome("~/.local/state")
+	}
+	return filepath.Join(stateHome, "pole", "history")
+}
+
+// loadHistory reads the queries in the history file, oldest first. A missing
+// file gives an empty history.
+func loadHistory(path string) ([]string, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read history: %s", err)
+	}
+	history := []string{}
+	for _, query := range strings.Split(string(contents), "\n") {
+		if query != "" {
+			history = addToHistory(history, query)
+		}
+	}
+	return history, nil
+}
+
+// addToHistory adds the query last, removing earlier occurrences of it and
+// the oldest queries if the history is full
+func addToHistory(history []string, query string) []string {
+	history = slices.DeleteFunc(history, func(q string) bool { return q == query })
+	history = append(history, query)
+	if len(history) > HISTORY_SIZE {
+		history = history[len(history)-HISTORY_SIZE:]
+	}
+	return history
+}
+
+func saveHistory(path string, history []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("Failed to create history directory: %s", err)
+	}
+	contents := strings.Join(history, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		return fmt.Errorf("Failed to write history: %s", err)
+	}
+	return nil
+}
+
+// saveQuery adds the query in the prompt to the history, if there is one
+func (u *Ui) saveQuery() {
+	query := strings.TrimSpace(u.Prompt.String())
+	if query == "" {
+		return
+	}
+	u.History = addToHistory(u.History, query)
+	if err := saveHistory(historyPath(), u.History); err != nil {
+		slog.Error("Failed to save query", "err", err)
+	}
+}
+
+// resetPrompt empties the prompt, keeping the query in the history
+func (u *Ui) resetPrompt() {
+	u.saveQuery()
+	u.Prompt = lineEditor{}
+}
+
+// searchHistory lets the user pick an earlier query, newest first, and puts
+// it in the prompt
+func (u *Ui) searchHistory() {
+	queries := slices.Clone(u.History)
+	slices.Reverse(queries)
+	u.pick("Search history", queries, nil, func(u *Ui, query string) command {
+		u.resetPrompt()
+		u.Prompt.set(query)
+		return u.newKeysView()
+	})
+}
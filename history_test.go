@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pole", "history")
+	history, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("Expected an empty history, got %v", history)
+	}
+	for _, query := range []string{"db", "prod", "db"} {
+		history = addToHistory(history, query)
+	}
+	if err := saveHistory(path, history); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	history, err = loadHistory(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if expected := []string{"prod", "db"}; !slices.Equal(history, expected) {
+		t.Fatalf("Expected %v, got %v", expected, history)
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	contents := ""
+	for i := 0; i < HISTORY_SIZE+10; i++ {
+		contents += fmt.Sprintf("query%d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write history: %s", err)
+	}
+	history, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(history) != HISTORY_SIZE {
+		t.Fatalf("Expected %d queries, got %d", HISTORY_SIZE, len(history))
+	}
+	if history[0] != "query10" {
+		t.Fatalf("Expected the oldest queries to be dropped, got %s first", history[0])
+	}
+}
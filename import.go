@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/slarwise/pole/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// ENV_EXT is the extension of the dotenv files in a directory that is
+// imported
+const ENV_EXT = ".env"
+
+// readImport reads the secrets in a json or yaml file, or in a directory of
+// dotenv files, by their path relative to where they are imported. A secret
+// without data, like a deleted secret in an export, is nil.
+func readImport(name string) (map[string]map[string]interface{}, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", name, err)
+	}
+	if info.IsDir() {
+		return readEnvDir(name)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", name, err)
+	}
+	var parsed interface{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		err = json.Unmarshal(content, &parsed)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &parsed)
+	default:
+		return nil, fmt.Errorf("Failed to read %s, expected a .json, .yaml or .yml file or a directory of %s files", name, ENV_EXT)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", name, err)
+	}
+	// Through json, so that numbers and maps are the same types for both
+	// formats and for the data in vault
+	bytes, err := json.Marshal(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", name, err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(bytes, &tree); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s, expected a mapping of paths to secrets", name)
+	}
+	return flattenImport(tree)
+}
+
+// flattenImport finds the secrets in a tree. Keys that start with /, like in
+// an export, are paths with the data of the secret as their value, or its
+// exportedSecret if the export has metadata or versions. Other
+// keys are directories, nested until the values have no mappings, like
+// {"app": {"db": {"password": "..."}}} for /app/db.
+func flattenImport(tree map[string]interface{}) (map[string]map[string]interface{}, error) {
+	secrets := map[string]map[string]interface{}{}
+	add := func(key string, data map[string]interface{}) error {
+		if _, found := secrets[key]; found {
+			return fmt.Errorf("Failed to import %s, it is given more than once", key)
+		}
+		secrets[key] = data
+		return nil
+	}
+	var walk func(dir string, tree map[string]interface{}) error
+	walk = func(dir string, tree map[string]interface{}) error {
+		for _, name := range sortedKeys(tree) {
+			key := dir + "/" + name
+			value, isMap := tree[name].(map[string]interface{})
+			if !isMap {
+				return fmt.Errorf("Failed to import %s, expected a secret or a directory", key)
+			}
+			dirs := 0
+			for _, v := range value {
+				if _, isMap := v.(map[string]interface{}); isMap {
+					dirs++
+				}
+			}
+			switch {
+			case dirs == 0:
+				if err := add(key, value); err != nil {
+					return err
+				}
+			case dirs == len(value):
+				if err := walk(key, value); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("Failed to import %s, it mixes fields and directories. Give secrets with mappings as values by their full path, like /app/db.", key)
+			}
+		}
+		return nil
+	}
+	nested := map[string]interface{}{}
+	for _, key := range sortedKeys(tree) {
+		if !strings.HasPrefix(key, "/") {
+			nested[key] = tree[key]
+			continue
+		}
+		data, isMap := tree[key].(map[string]interface{})
+		if !isMap && tree[key] != nil {
+			return nil, fmt.Errorf("Failed to import %s, expected its fields or null", key)
+		}
+		if latest, exported := exportedData(data); exported {
+			data = latest
+		}
+		if err := add(key, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := walk("", nested); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// exportedData is the data of the latest version if value is an
+// exportedSecret, like from an export with -metadata or -versions. Its
+// metadata and older versions are not imported.
+func exportedData(value map[string]interface{}) (map[string]interface{}, bool) {
+	for field := range value {
+		if field != "data" && field != "metadata" && field != "versions" {
+			return nil, false
+		}
+	}
+	_, hasMetadata := value["metadata"].(map[string]interface{})
+	_, hasVersions := value["versions"].([]interface{})
+	if !hasMetadata && !hasVersions {
+		return nil, false
+	}
+	data, _ := value["data"].(map[string]interface{})
+	return data, true
+}
+
+// readEnvDir reads the dotenv files in dir, with dir/app/db.env as /app/db.
+// A file named only .env is the secret at its directory, like app/.env for
+// /app.
+func readEnvDir(dir string) (map[string]map[string]interface{}, error) {
+	secrets := map[string]map[string]interface{}{}
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(name) != ENV_EXT {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, strings.TrimSuffix(name, ENV_EXT))
+		if err != nil {
+			return err
+		}
+		key := path.Clean("/" + filepath.ToSlash(rel))
+		if _, found := secrets[key]; found {
+			return fmt.Errorf("Failed to import %s, it is given more than once", key)
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		data, err := parseEnv(file, name)
+		if err != nil {
+			return err
+		}
+		secrets[key] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", dir, err)
+	}
+	return secrets, nil
+}
+
+// MAX_ENV_LINE is the longest line that an env file can have, long enough
+// for values like PEM keys with escaped line breaks
+const MAX_ENV_LINE = 1024 * 1024
+
+// parseEnv parses lines of KEY=VALUE. Blank lines and lines starting with #
+// are skipped, and a leading export is allowed. Values in double quotes can
+// have escapes like \n, values in single quotes are taken as they are and
+// unquoted values end at " #". Errors never have the values in them.
+func parseEnv(r io.Reader, name string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MAX_ENV_LINE)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("Failed to parse %s line %d, expected KEY=VALUE", name, n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse %s line %d, the value of %s has an invalid escape", name, n, key)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'"):
+			return nil, fmt.Errorf("Failed to parse %s line %d, the value of %s has no closing quote", name, n, key)
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		data[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", name, err)
+	}
+	return data, nil
+}
+
+// importKey is the key in the mount that a secret is imported to, below
+// prefix
+func importKey(prefix, key string) (string, error) {
+	if slices.Contains(strings.Split(key, "/"), "..") {
+		return "", fmt.Errorf("Failed to import %s, paths can't contain ..", key)
+	}
+	joined := path.Join("/", prefix, key)
+	if joined == "/" {
+		return "", fmt.Errorf("Failed to import %s, it is the root of the mount", key)
+	}
+	return joined, nil
+}
+
+// planImport compares the secrets with the ones in the mount and decides
+// which to create and update. Each step has the version that the secret is
+// expected to be at when it is written.
+func planImport(ctx context.Context, client vault.Client, mount string, secrets map[string]map[string]interface{}, concurrency int) []syncStep {
+	keys := sortedKeys(secrets)
+	steps := make([]syncStep, len(keys))
+	limit := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		steps[i].Key = key
+		wg.Add(1)
+		go func(step *syncStep) {
+			defer wg.Done()
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				step.Action = SYNC_FAILED
+				step.Reason = ctx.Err().Error()
+				return
+			}
+			defer func() { <-limit }()
+			*step = planImportStep(ctx, client, mount, step.Key, secrets[step.Key])
+		}(&steps[i])
+	}
+	wg.Wait()
+	return steps
+}
+
+func planImportStep(ctx context.Context, client vault.Client, mount, key string, data map[string]interface{}) syncStep {
+	step := syncStep{Key: key, data: data}
+	if data == nil {
+		step.Action = SYNC_SKIP
+		step.Reason = "no data in the file"
+		return step
+	}
+	current, err := client.GetSecret(ctx, mount, key)
+	var responseErr *vault.ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound {
+		step.Action = SYNC_CREATE
+		return step
+	}
+	if err != nil {
+		step.Action = SYNC_FAILED
+		step.Reason = err.Error()
+		return step
+	}
+	version, _ := current.Data.Metadata["version"].(float64)
+	step.version = int(version)
+	if current.Data.Data == nil {
+		step.Action = SYNC_UPDATE
+		step.Reason = "deleted in vault"
+		return step
+	}
+	diff := secretDiff{Changes: diffData(current.Data.Data, data)}
+	if !diff.differs() {
+		step.Action = SYNC_UNCHANGED
+		return step
+	}
+	step.Action = SYNC_UPDATE
+	step.Reason = diff.summary()
+	return step
+}
+
+// applyImport writes the secrets that are created or updated in the plan,
+// with check-and-set so that secrets that have changed since the plan are
+// not overwritten. The steps that could not be written are marked as failed.
+func applyImport(ctx context.Context, client vault.Client, mount string, steps []syncStep, concurrency int) {
+	limit := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range steps {
+		step := &steps[i]
+		if step.Action != SYNC_CREATE && step.Action != SYNC_UPDATE {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				step.Action = SYNC_FAILED
+				step.Reason = ctx.Err().Error()
+				return
+			}
+			defer func() { <-limit }()
+			err := client.PutSecretCAS(ctx, mount, step.Key, step.data, step.version)
+			if errors.Is(err, vault.ErrCheckAndSet) {
+				step.Action = SYNC_FAILED
+				step.Reason = "changed in vault since the plan was made"
+			} else if err != nil {
+				step.Action = SYNC_FAILED
+				step.Reason = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func importCommand(ctx context.Context, vaultClient vault.Client, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only print what would be done")
+	concurrency := flags.Int("concurrency", vault.DEFAULT_CONCURRENCY, "max number of secrets to read or write at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("Usage: pole import [-dry-run] [-concurrency n] <file or directory> <mount>[/<prefix>]")
+	}
+	source, destination := flags.Arg(0), flags.Arg(1)
+	secrets, err := readImport(source)
+	if err != nil {
+		return err
+	}
+	mounts, err := vaultClient.GetMounts(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get mounts: %s", err)
+	}
+	mount, prefix, err := splitMountPath(strings.TrimSuffix(destination, "/"), mounts)
+	if err != nil {
+		return err
+	}
+	byKey := map[string]map[string]interface{}{}
+	for name, data := range secrets {
+		key, err := importKey(prefix, name)
+		if err != nil {
+			return err
+		}
+		if _, found := byKey[key]; found {
+			return fmt.Errorf("Failed to import %s, it is given more than once", key)
+		}
+		byKey[key] = data
+	}
+	steps := planImport(ctx, vaultClient, mount, byKey, *concurrency)
+	fmt.Printf("Plan for importing %s to %s:\n", source, mount+prefix)
+	if err := writePlan(os.Stdout, steps); err != nil {
+		return fmt.Errorf("Failed to write plan: %s", err)
+	}
+	failed := 0
+	if !*dryRun {
+		applyImport(ctx, vaultClient, mount, steps, *concurrency)
+	}
+	for _, step := range steps {
+		if step.Action == SYNC_FAILED {
+			failed++
+			fmt.Fprintf(os.Stderr, "Failed to import %s: %s\n", step.Key, step.Reason)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to import %d of %d secrets", failed, len(steps))
+	}
+	if !*dryRun {
+		fmt.Println("Done")
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/slarwise/pole/vault"
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+func TestFlattenImport(t *testing.T) {
+	tests := map[string]struct {
+		tree     map[string]interface{}
+		expected map[string]map[string]interface{}
+		err      string
+	}{
+		"paths": {
+			tree: map[string]interface{}{
+				"/app/db":  map[string]interface{}{"password": "x", "options": map[string]interface{}{"ssl": true}},
+				"/deleted": nil,
+			},
+			expected: map[string]map[string]interface{}{
+				"/app/db":  {"password": "x", "options": map[string]interface{}{"ssl": true}},
+				"/deleted": nil,
+			},
+		},
+		"export with metadata and versions": {
+			tree: map[string]interface{}{
+				"/app/db": map[string]interface{}{
+					"data":     map[string]interface{}{"password": "x"},
+					"metadata": map[string]interface{}{"current_version": 2.0},
+					"versions": []interface{}{map[string]interface{}{"version": 1.0}},
+				},
+				"/deleted": map[string]interface{}{
+					"metadata": map[string]interface{}{"current_version": 1.0},
+				},
+			},
+			expected: map[string]map[string]interface{}{
+				"/app/db":  {"password": "x"},
+				"/deleted": nil,
+			},
+		},
+		"nested": {
+			tree: map[string]interface{}{
+				"app": map[string]interface{}{
+					"db":  map[string]interface{}{"password": "x"},
+					"api": map[string]interface{}{"token": "y"},
+				},
+				"b": map[string]interface{}{},
+			},
+			expected: map[string]map[string]interface{}{
+				"/app/db":  {"password": "x"},
+				"/app/api": {"token": "y"},
+				"/b":       {},
+			},
+		},
+		"mixed": {
+			tree: map[string]interface{}{
+				"app": map[string]interface{}{"db": map[string]interface{}{"password": "x"}, "token": "y"},
+			},
+			err: "/app, it mixes fields and directories",
+		},
+		"not a secret": {
+			tree: map[string]interface{}{"app": "x"},
+			err:  "/app, expected a secret or a directory",
+		},
+		"twice": {
+			tree: map[string]interface{}{
+				"/app/db": map[string]interface{}{"password": "x"},
+				"app":     map[string]interface{}{"db": map[string]interface{}{"password": "y"}},
+			},
+			err: "/app/db, it is given more than once",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := flattenImport(test.tree)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected an error with %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected map[string]interface{}
+		err      string
+	}{
+		"values": {
+			input: "# comment\n\nA=1\nexport B = two words\nC=\"line\\nbreak\"\nD='$not #expanded'\nE=x # comment\nF=\n",
+			expected: map[string]interface{}{
+				"A": "1", "B": "two words", "C": "line\nbreak", "D": "$not #expanded", "E": "x", "F": "",
+			},
+		},
+		"long line": {
+			input:    "KEY=\"" + strings.Repeat("x", 100*1024) + "\"\nB=1\n",
+			expected: map[string]interface{}{"KEY": strings.Repeat("x", 100*1024), "B": "1"},
+		},
+		"no equals": {
+			input: "A=1\nhunter2\n",
+			err:   "line 2, expected KEY=VALUE",
+		},
+		"no closing quote": {
+			input: "A=\"hunter2\n",
+			err:   "line 1, the value of A has no closing quote",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseEnv(strings.NewReader(test.input), "test.env")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected an error with %q, got %v", test.err, err)
+				}
+				if strings.Contains(err.Error(), "hunter2") {
+					t.Fatalf("Expected the error to not have the value, got %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	tests := map[string]struct {
+		prefix   string
+		key      string
+		expected string
+		err      bool
+	}{
+		"root":      {prefix: "/", key: "/app/db", expected: "/app/db"},
+		"prefix":    {prefix: "/svc", key: "/app/db", expected: "/svc/app/db"},
+		"prefix /":  {prefix: "/svc/", key: "/db", expected: "/svc/db"},
+		"at prefix": {prefix: "/svc", key: "/", expected: "/svc"},
+		"mount":     {prefix: "/", key: "/", err: true},
+		"escape":    {prefix: "/svc", key: "/../db", err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := importKey(test.prefix, test.key)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if got != test.expected {
+				t.Fatalf("Expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	server := vaulttest.NewServer(SYNC_TOKEN)
+	defer server.Close()
+	server.Put("secret", "/same", map[string]interface{}{"a": "same", "n": 1})
+	server.Put("secret", "/changed", map[string]interface{}{"a": "vault", "b": "removed"})
+	server.Put("secret", "/raced", map[string]interface{}{"a": "vault"})
+	server.Delete("secret", "/deleted", server.Put("secret", "/deleted", map[string]interface{}{"a": "vault"}))
+	client := vault.NewClient(server.URL, vault.WithToken(SYNC_TOKEN))
+	secrets := map[string]map[string]interface{}{
+		"/new":     {"a": "file"},
+		"/same":    {"a": "same", "n": 1.0},
+		"/changed": {"a": "file"},
+		"/raced":   {"a": "file"},
+		"/deleted": {"a": "file"},
+		"/empty":   nil,
+	}
+	steps := planImport(context.Background(), client, "secret", secrets, 2)
+	actions := map[string]string{}
+	reasons := map[string]string{}
+	for _, step := range steps {
+		actions[step.Key] = step.Action
+		reasons[step.Key] = step.Reason
+	}
+	expected := map[string]string{
+		"/new": SYNC_CREATE, "/same": SYNC_UNCHANGED, "/changed": SYNC_UPDATE, "/raced": SYNC_UPDATE, "/deleted": SYNC_UPDATE, "/empty": SYNC_SKIP,
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected the plan %v, got %v", expected, actions)
+	}
+	if reasons["/changed"] != "1 removed, 1 changed" {
+		t.Fatalf("Expected the changes as the reason for /changed, got %s", reasons["/changed"])
+	}
+	// Written after the plan was made, so importing it must not overwrite it
+	server.Put("secret", "/raced", map[string]interface{}{"a": "someone else"})
+	applyImport(context.Background(), client, "secret", steps, 2)
+	for _, step := range steps {
+		if step.Key == "/raced" {
+			if step.Action != SYNC_FAILED {
+				t.Fatalf("Expected /raced to fail check-and-set, got %s", step.Action)
+			}
+			continue
+		}
+		if step.Action == SYNC_FAILED {
+			t.Fatalf("Expected %s to be written, got %s", step.Key, step.Reason)
+		}
+	}
+	expectedData := map[string]string{"/new": "file", "/same": "same", "/changed": "file", "/raced": "someone else", "/deleted": "file"}
+	for key, a := range expectedData {
+		secret, err := vault.NewClient(server.URL, vault.WithToken(SYNC_TOKEN)).GetSecret(context.Background(), "secret", key)
+		if err != nil {
+			t.Fatalf("Expected to read %s, got %s", key, err)
+		}
+		if secret.Data.Data["a"] != a {
+			t.Fatalf("Expected field a of %s to be %s, got %v", key, a, secret.Data.Data["a"])
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// keyPress is a key together with the modifiers that matter for matching it
+// against the keymap
+type keyPress struct {
+	Key  tcell.Key
+	Rune rune
+	Mod  tcell.ModMask
+}
+
+// keyOf normalizes a key event. Control characters and runes already carry
+// their modifiers, so Ctrl and Shift are dropped for them.
+func keyOf(ev *tcell.EventKey) keyPress {
+	key := ev.Key()
+	mod := ev.Modifiers() & (tcell.ModAlt | tcell.ModCtrl | tcell.ModShift)
+	switch {
+	case key == tcell.KeyRune:
+		return keyPress{Key: key, Rune: ev.Rune(), Mod: mod & tcell.ModAlt}
+	case key == tcell.KeyBackspace2:
+		return keyPress{Key: tcell.KeyBackspace, Mod: mod &^ tcell.ModCtrl}
+	case key <= tcell.KeyCtrlUnderscore:
+		return keyPress{Key: key, Mod: mod &^ (tcell.ModCtrl | tcell.ModShift)}
+	}
+	return keyPress{Key: key, Mod: mod}
+}
+
+var keysByName = func() map[string]tcell.Key {
+	keys := make(map[string]tcell.Key)
+	for key, name := range tcell.KeyNames {
+		keys[strings.ToLower(name)] = key
+	}
+	return keys
+}()
+
+// parseKey parses keys like `Ctrl-K`, `Alt-b`, `Shift-Up`, `Enter`, `Space`
+// and `,`
+func parseKey(s string) (keyPress, error) {
+	var mod tcell.ModMask
+	rest := s
+	for {
+		lower := strings.ToLower(rest)
+		if strings.HasPrefix(lower, "alt-") && len(rest) > 4 {
+			mod |= tcell.ModAlt
+			rest = rest[4:]
+		} else if strings.HasPrefix(lower, "shift-") && len(rest) > 6 {
+			mod |= tcell.ModShift
+			rest = rest[6:]
+		} else {
+			break
+		}
+	}
+	if utf8.RuneCountInString(rest) == 1 {
+		if mod&tcell.ModShift != 0 {
+			return keyPress{}, fmt.Errorf("Invalid key %s, use the upper case letter instead of Shift", s)
+		}
+		r, _ := utf8.DecodeRuneInString(rest)
+		return keyPress{Key: tcell.KeyRune, Rune: r, Mod: mod}, nil
+	}
+	if strings.ToLower(rest) == "space" {
+		return keyPress{Key: tcell.KeyRune, Rune: ' ', Mod: mod}, nil
+	}
+	if key, found := keysByName[strings.ToLower(rest)]; found {
+		return keyOf(tcell.NewEventKey(key, 0, mod)), nil
+	}
+	if strings.HasPrefix(strings.ToLower(rest), "ctrl-") {
+		if key, found := keysByName[strings.ToLower(rest[5:])]; found {
+			return keyPress{Key: key, Mod: mod | tcell.ModCtrl}, nil
+		}
+	}
+	return keyPress{}, fmt.Errorf("Unknown key %s", s)
+}
+
+func (k keyPress) String() string {
+	name := ""
+	switch {
+	case k.Key == tcell.KeyRune && k.Rune == ' ':
+		name = "Space"
+	case k.Key == tcell.KeyRune:
+		name = string(k.Rune)
+	default:
+		name = tcell.KeyNames[k.Key]
+	}
+	if k.Mod&tcell.ModCtrl != 0 {
+		name = "Ctrl-" + name
+	}
+	if k.Mod&tcell.ModShift != 0 {
+		name = "Shift-" + name
+	}
+	if k.Mod&tcell.ModAlt != 0 {
+		name = "Alt-" + name
+	}
+	return name
+}
+
+// action is something that keys can be bound to. Run returns the command to
+// run for it, like update.
+type action struct {
+	Description string
+	Run         func(u *Ui) command
+}
+
+// ACTIONS are all actions by name, they are listed in the help and in the
+// command palette. They are set in init since some of them list the actions.
+var ACTIONS map[string]action
+
+func init() {
+	ACTIONS = map[string]action{
+		"quit": {
+			Description: "Exit pole",
+			Run: func(u *Ui) command {
+				u.Quit = true
+				return nil
+			},
+		},
+		"select": {
+			Description: "Exit and print the secret as json",
+			Run: func(u *Ui) command {
+				if !(reflect.ValueOf(u.Secret).IsZero()) {
+					bytes, err := json.MarshalIndent(u.Secret, "", "  ")
+					if err != nil {
+						panic(fmt.Sprintf("Failed to marshal secret: %s", err))
+					}
+					u.Result = bytes
+				}
+				u.Quit = true
+				return nil
+			},
+		},
+		"open-in-browser": {
+			Description: "Open the secret in the vault web ui",
+			Run: func(u *Ui) command {
+				return u.openInBrowser()
+			},
+		},
+		"copy-field": {
+			Description: "Copy the value of the selected field",
+			Run: func(u *Ui) command {
+				return u.copyField()
+			},
+		},
+		"next-field": {
+			Description: "Select the next field in the secret",
+			Run: func(u *Ui) command {
+				if fields := u.fields(); len(fields) > 0 {
+					u.Field = (u.Field + 1) % len(fields)
+				}
+				return nil
+			},
+		},
+		"previous-field": {
+			Description: "Select the previous field in the secret",
+			Run: func(u *Ui) command {
+				if fields := u.fields(); len(fields) > 0 {
+					u.Field = (u.Field - 1 + len(fields)) % len(fields)
+				}
+				return nil
+			},
+		},
+		"toggle-report": {
+			Description: "Show the paths that could not be listed",
+			Run: func(u *Ui) command {
+				u.ShowReport = !u.ShowReport
+				return nil
+			},
+		},
+		"help": {
+			Description: "Show all actions and their keys",
+			Run: func(u *Ui) command {
+				u.showHelpOverlay()
+				return nil
+			},
+		},
+		"command-palette": {
+			Description: "Search for an action to run",
+			Run: func(u *Ui) command {
+				u.commandPalette()
+				return nil
+			},
+		},
+		"switch-mount": {
+			Description: "Pick a mount to show the keys in",
+			Run: func(u *Ui) command {
+				u.switchMount()
+				return nil
+			},
+		},
+		"copy-as-cli": {
+			Description: "Copy the vault cli command that reads the secret",
+			Run: func(u *Ui) command {
+				u.copyAsCli()
+				return nil
+			},
+		},
+		"toggle-help": {
+			Description: "Show or hide the help line",
+			Run: func(u *Ui) command {
+				u.ShowHelp = !u.ShowHelp
+				return nil
+			},
+		},
+		"switch-profile": {
+			Description: "Switch to another profile",
+			Run: func(u *Ui) command {
+				u.pickProfile()
+				return nil
+			},
+		},
+		"delete-char": {
+			Description: "Delete the character before the cursor",
+			Run: func(u *Ui) command {
+				if u.Prompt.Cursor > 0 {
+					u.Prompt.deleteBack()
+					return u.newKeysView()
+				}
+				return nil
+			},
+		},
+		"clear-prompt": {
+			Description: "Clear the prompt",
+			Run: func(u *Ui) command {
+				u.resetPrompt()
+				return u.newKeysView()
+			},
+		},
+		"move-cursor-left": {
+			Description: "Move the cursor in the prompt one character left",
+			Run: func(u *Ui) command {
+				u.Prompt.left()
+				return nil
+			},
+		},
+		"move-cursor-right": {
+			Description: "Move the cursor in the prompt one character right",
+			Run: func(u *Ui) command {
+				u.Prompt.right()
+				return nil
+			},
+		},
+		"beginning-of-line": {
+			Description: "Move the cursor to the beginning of the prompt",
+			Run: func(u *Ui) command {
+				u.Prompt.home()
+				return nil
+			},
+		},
+		"end-of-line": {
+			Description: "Move the cursor to the end of the prompt",
+			Run: func(u *Ui) command {
+				u.Prompt.end()
+				return nil
+			},
+		},
+		"backward-word": {
+			Description: "Move the cursor to the beginning of the word",
+			Run: func(u *Ui) command {
+				u.Prompt.wordLeft()
+				return nil
+			},
+		},
+		"forward-word": {
+			Description: "Move the cursor to the end of the word",
+			Run: func(u *Ui) command {
+				u.Prompt.wordRight()
+				return nil
+			},
+		},
+		"delete-word": {
+			Description: "Delete the word before the cursor",
+			Run: func(u *Ui) command {
+				if u.Prompt.Cursor > 0 {
+					u.Prompt.deleteWordBack()
+					return u.newKeysView()
+				}
+				return nil
+			},
+		},
+		"search-history": {
+			Description: "Search the earlier queries",
+			Run: func(u *Ui) command {
+				u.searchHistory()
+				return nil
+			},
+		},
+		"toggle-pane": {
+			Description: "Switch between the keys and the secret in single pane mode",
+			Run: func(u *Ui) command {
+				u.ShowDetail = !u.ShowDetail
+				return nil
+			},
+		},
+		"grow-list": {
+			Description: "Give more space to the keys",
+			Run: func(u *Ui) command {
+				u.resizeList(SPLIT_STEP)
+				return nil
+			},
+		},
+		"shrink-list": {
+			Description: "Give more space to the secret",
+			Run: func(u *Ui) command {
+				u.resizeList(-SPLIT_STEP)
+				return nil
+			},
+		},
+		"toggle-orientation": {
+			Description: "Show the keys next to or above the secret",
+			Run: func(u *Ui) command {
+				if u.Layout.Orientation == ORIENTATION_HORIZONTAL {
+					u.Layout.Orientation = ORIENTATION_VERTICAL
+				} else {
+					u.Layout.Orientation = ORIENTATION_HORIZONTAL
+				}
+				u.resetView()
+				return nil
+			},
+		},
+		"next-mount": {
+			Description: "Show the keys in the next mount",
+			Run: func(u *Ui) command {
+				return u.nextMount()
+			},
+		},
+		"previous-mount": {
+			Description: "Show the keys in the previous mount",
+			Run: func(u *Ui) command {
+				return u.previousMount()
+			},
+		},
+		"diff": {
+			Description: "Compare the secret with an earlier version or another secret",
+			Run: func(u *Ui) command {
+				return u.diffSecret()
+			},
+		},
+		"toggle-reveal": {
+			Description: "Show or mask the values in the diff",
+			Run: func(u *Ui) command {
+				u.RevealDiff = !u.RevealDiff
+				return nil
+			},
+		},
+		"drift": {
+			Description: "Show the paths that differ between the mount and other mounts",
+			Run: func(u *Ui) command {
+				u.driftMounts()
+				return nil
+			},
+		},
+		"copy-secret": {
+			Description: "Copy the secret or a directory it is in to another path",
+			Run: func(u *Ui) command {
+				u.copySecret(false, false)
+				return nil
+			},
+		},
+		"copy-with-metadata": {
+			Description: "Copy the secret or a directory it is in with its custom metadata",
+			Run: func(u *Ui) command {
+				u.copySecret(false, true)
+				return nil
+			},
+		},
+		"move-secret": {
+			Description: "Move or rename the secret or a directory it is in",
+			Run: func(u *Ui) command {
+				u.copySecret(true, true)
+				return nil
+			},
+		},
+		"move-up": {
+			Description: "Move the cursor up",
+			Run: func(u *Ui) command {
+				return u.cursorUp()
+			},
+		},
+		"move-down": {
+			Description: "Move the cursor down",
+			Run: func(u *Ui) command {
+				return u.cursorDown()
+			},
+		},
+	}
+}
+
+// DEFAULT_KEYS binds every action. A binding is one key or a sequence of keys
+// separated by spaces. Runes that aren't bound are typed into the prompt, so
+// bindings should have a modifier or start with a key that isn't a rune.
+var DEFAULT_KEYS = map[string][]string{
+	"quit":               {"Esc", "Ctrl-C"},
+	"select":             {"Enter"},
+	"open-in-browser":    {"Ctrl-O"},
+	"copy-field":         {"Ctrl-Y"},
+	"next-field":         {"Tab"},
+	"previous-field":     {"Backtab"},
+	"toggle-report":      {"Ctrl-T"},
+	"help":               {"F1", "Ctrl-G ?"},
+	"command-palette":    {"Alt-x", "Ctrl-Space"},
+	"switch-mount":       {},
+	"copy-as-cli":        {},
+	"toggle-help":        {},
+	"switch-profile":     {"Ctrl-S"},
+	"delete-char":        {"Backspace"},
+	"clear-prompt":       {"Ctrl-U"},
+	"delete-word":        {"Ctrl-W"},
+	"move-cursor-left":   {"Left", "Ctrl-B"},
+	"move-cursor-right":  {"Right", "Ctrl-F"},
+	"beginning-of-line":  {"Ctrl-A", "Home"},
+	"end-of-line":        {"Ctrl-E", "End"},
+	"backward-word":      {"Alt-b"},
+	"forward-word":       {"Alt-f"},
+	"search-history":     {"Ctrl-R"},
+	"toggle-pane":        {"Ctrl-L"},
+	"grow-list":          {"Alt-="},
+	"shrink-list":        {"Alt--"},
+	"toggle-orientation": {},
+	"next-mount":         {"Alt-Left", "Ctrl-G ,"},
+	"previous-mount":     {"Alt-Right", "Ctrl-G ;"},
+	"diff":               {"Ctrl-G d"},
+	"toggle-reveal":      {"Ctrl-G r"},
+	"drift":              {"Ctrl-G m"},
+	"copy-secret":        {},
+	"copy-with-metadata": {},
+	"move-secret":        {},
+	"move-up":            {"Up", "Ctrl-K", "Ctrl-P"},
+	"move-down":          {"Down", "Ctrl-J", "Ctrl-N"},
+}
+
+// keymap maps key sequences to actions. Sequences are stored by their
+// canonical name, see sequenceName.
+type keymap struct {
+	actions map[string]string
+	// keys are the bindings of each action in the order they were given
+	keys map[string][]string
+	// prefixes are the beginnings of the sequences that are longer than one
+	// key
+	prefixes map[string]bool
+}
+
+func sequenceName(keys []keyPress) string {
+	names := []string{}
+	for _, k := range keys {
+		names = append(names, k.String())
+	}
+	return strings.Join(names, " ")
+}
+
+func parseSequence(s string) ([]keyPress, error) {
+	keys := []keyPress{}
+	for _, field := range strings.Fields(s) {
+		key, err := parseKey(field)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Empty key binding")
+	}
+	return keys, nil
+}
+
+// newKeymap binds the default keys, with the keys of the actions in
+// overrides replaced. A key bound in overrides is removed from the default
+// bindings of other actions.
+func newKeymap(overrides map[string][]string) (keymap, error) {
+	m := keymap{
+		actions:  make(map[string]string),
+		keys:     make(map[string][]string),
+		prefixes: make(map[string]bool),
+	}
+	bind := func(action string, seq []keyPress) {
+		name := sequenceName(seq)
+		if previous, found := m.actions[name]; found {
+			m.keys[previous] = slices.DeleteFunc(m.keys[previous], func(k string) bool { return k == name })
+		}
+		m.actions[name] = action
+		m.keys[action] = append(m.keys[action], name)
+	}
+	for _, action := range sortedKeys(DEFAULT_KEYS) {
+		if _, found := overrides[action]; found {
+			continue
+		}
+		for _, k := range DEFAULT_KEYS[action] {
+			seq, err := parseSequence(k)
+			if err != nil {
+				return keymap{}, err
+			}
+			bind(action, seq)
+		}
+	}
+	overridden := make(map[string]string)
+	for _, action := range sortedKeys(overrides) {
+		if _, found := ACTIONS[action]; !found {
+			return keymap{}, fmt.Errorf("Unknown action %s", action)
+		}
+		m.keys[action] = []string{}
+		for _, k := range overrides[action] {
+			seq, err := parseSequence(k)
+			if err != nil {
+				return keymap{}, err
+			}
+			name := sequenceName(seq)
+			if other, found := overridden[name]; found {
+				return keymap{}, fmt.Errorf("The key %s is bound to both %s and %s", k, other, action)
+			}
+			overridden[name] = action
+			bind(action, seq)
+		}
+	}
+	// A sequence that starts with a bound key could never be completed, so
+	// the default binding of the shorter key is removed unless it was set by
+	// the user
+	for _, action := range sortedKeys(m.keys) {
+		for _, name := range m.keys[action] {
+			seq, _ := parseSequence(name)
+			for i := 1; i < len(seq); i++ {
+				prefix := sequenceName(seq[:i])
+				if other, found := m.actions[prefix]; found {
+					if _, byUser := overridden[prefix]; byUser {
+						return keymap{}, fmt.Errorf("The key %s is bound to %s and starts the sequence %s for %s", prefix, other, name, action)
+					}
+					m.keys[other] = slices.DeleteFunc(m.keys[other], func(k string) bool { return k == prefix })
+					delete(m.actions, prefix)
+				}
+				m.prefixes[prefix] = true
+			}
+		}
+	}
+	return m, nil
+}
+
+// sortedKeys are the keys of the map, sorted
+func sortedKeys[T any](m map[string]T) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// lookup finds the action bound to the sequence. If the sequence is the
+// beginning of a longer binding, pending is true.
+func (m keymap) lookup(seq []keyPress) (action string, pending bool) {
+	name := sequenceName(seq)
+	if action, found := m.actions[name]; found {
+		return action, false
+	}
+	return "", m.prefixes[name]
+}
+
+// keysOf returns the bindings of the action, an empty slice if it is unbound
+func (m keymap) keysOf(action string) []string {
+	return m.keys[action]
+}
+
+// handleKey runs the action bound to the key, or types it into the prompt if
+// nothing is bound to it. Keys that begin a sequence are kept until the
+// sequence is complete.
+func (u *Ui) handleKey(ev *tcell.EventKey) command {
+	if u.Pasting {
+		if ev.Key() == tcell.KeyRune {
+			u.pasted = append(u.pasted, ev.Rune())
+		}
+		return nil
+	}
+	seq := append(u.PendingKeys, keyOf(ev))
+	action, pending := u.Keymap.lookup(seq)
+	if pending {
+		u.PendingKeys = seq
+		return nil
+	}
+	u.PendingKeys = nil
+	if action != "" {
+		return ACTIONS[action].Run(u)
+	}
+	// An unknown sequence is dropped, so that the keys in it aren't typed
+	if len(seq) == 1 && ev.Key() == tcell.KeyRune && ev.Modifiers()&tcell.ModAlt == 0 {
+		u.Prompt.insert(string(ev.Rune()))
+		return u.newKeysView()
+	}
+	return nil
+}
+
+var KEY_SYMBOLS = map[string]string{"Up": "↑", "Down": "↓", "Left": "←", "Right": "→"}
+
+// keyHint shows the first key bound to each of the actions, arrows as
+// symbols and other keys in angle brackets. It is empty if one of the
+// actions is unbound.
+func (m keymap) keyHint(actions ...string) string {
+	hint := ""
+	for _, action := range actions {
+		keys := m.keysOf(action)
+		if len(keys) == 0 {
+			return ""
+		}
+		if symbol, found := KEY_SYMBOLS[keys[0]]; found {
+			hint += symbol
+		} else {
+			hint += fmt.Sprintf("<%s>", keys[0])
+		}
+	}
+	return hint
+}
+
+// helpLine describes the most used actions with the keys they are bound to
+func (u Ui) helpLine() string {
+	entries := []struct {
+		name    string
+		actions []string
+	}{
+		{"Move", []string{"move-up", "move-down"}},
+		{"Change mount", []string{"next-mount", "previous-mount"}},
+		{"Copy", []string{"copy-field"}},
+		{"Help", []string{"help"}},
+		{"Exit", []string{"quit"}},
+	}
+	parts := []string{}
+	for _, e := range entries {
+		if hint := u.Keymap.keyHint(e.actions...); hint != "" {
+			parts = append(parts, e.name+" "+hint)
+		}
+	}
+	return strings.Join(parts, " ")
+}
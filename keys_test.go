@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := map[string]struct {
+		key      string
+		expected keyPress
+		err      bool
+	}{
+		"rune":       {key: ",", expected: keyPress{Key: tcell.KeyRune, Rune: ','}},
+		"upper-case": {key: "K", expected: keyPress{Key: tcell.KeyRune, Rune: 'K'}},
+		"ctrl":       {key: "Ctrl-K", expected: keyPress{Key: tcell.KeyCtrlK}},
+		"alt":        {key: "Alt-b", expected: keyPress{Key: tcell.KeyRune, Rune: 'b', Mod: tcell.ModAlt}},
+		"named":      {key: "Enter", expected: keyPress{Key: tcell.KeyEnter}},
+		"lower-case": {key: "esc", expected: keyPress{Key: tcell.KeyEscape}},
+		"space":      {key: "Space", expected: keyPress{Key: tcell.KeyRune, Rune: ' '}},
+		"shift":      {key: "Shift-Up", expected: keyPress{Key: tcell.KeyUp, Mod: tcell.ModShift}},
+		"ctrl-arrow": {key: "Ctrl-Up", expected: keyPress{Key: tcell.KeyUp, Mod: tcell.ModCtrl}},
+		"shift-rune": {key: "Shift-k", err: true},
+		"unknown":    {key: "Hyper-K", err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := parseKey(test.key)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error, got %v", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if key != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	tests := map[string]struct {
+		ev       *tcell.EventKey
+		expected string
+	}{
+		"ctrl":       {ev: tcell.NewEventKey(tcell.KeyCtrlK, 0, tcell.ModCtrl), expected: "Ctrl-K"},
+		"backspace2": {ev: tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone), expected: "Backspace"},
+		"shift-rune": {ev: tcell.NewEventKey(tcell.KeyRune, 'K', tcell.ModShift), expected: "K"},
+		"alt-rune":   {ev: tcell.NewEventKey(tcell.KeyRune, 'b', tcell.ModAlt), expected: "Alt-b"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key := keyOf(test.ev)
+			expected, err := parseKey(test.expected)
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if key != expected {
+				t.Fatalf("Expected %v, got %v", expected, key)
+			}
+			if key.String() != test.expected {
+				t.Fatalf("Expected %s, got %s", test.expected, key.String())
+			}
+		})
+	}
+}
+
+func TestNewKeymap(t *testing.T) {
+	tests := map[string]struct {
+		overrides map[string][]string
+		sequence  string
+		action    string
+		pending   bool
+		err       bool
+	}{
+		"default":            {sequence: "Ctrl-K", action: "move-up"},
+		"default-sequence":   {sequence: "Ctrl-G ,", action: "next-mount"},
+		"prefix":             {sequence: "Ctrl-G", pending: true},
+		"comma-is-typed":     {sequence: ","},
+		"question-is-typed":  {sequence: "?"},
+		"help":               {sequence: "F1", action: "help"},
+		"override":           {overrides: map[string][]string{"toggle-help": {"Ctrl-K"}}, sequence: "Ctrl-K", action: "toggle-help"},
+		"override-sequence":  {overrides: map[string][]string{"next-mount": {"g n"}}, sequence: "g n", action: "next-mount"},
+		"override-prefix":    {overrides: map[string][]string{"next-mount": {"Ctrl-K n"}}, sequence: "Ctrl-K", pending: true},
+		"replaced-defaults":  {overrides: map[string][]string{"next-mount": {"Ctrl-B"}}, sequence: "Alt-Left"},
+		"user-bound-prefix":  {overrides: map[string][]string{"quit": {"Ctrl-B"}, "next-mount": {"Ctrl-B n"}}, err: true},
+		"unknown-action":     {overrides: map[string][]string{"fly": {"Ctrl-F"}}, err: true},
+		"bound-twice":        {overrides: map[string][]string{"quit": {"Ctrl-Q"}, "select": {"Ctrl-Q"}}, err: true},
+		"unrelated-override": {overrides: map[string][]string{"quit": {"Ctrl-Q"}}, sequence: "Enter", action: "select"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := newKeymap(test.overrides)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			seq, err := parseSequence(test.sequence)
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			action, pending := m.lookup(seq)
+			if action != test.action || pending != test.pending {
+				t.Fatalf("Expected action %q and pending %t, got %q and %t", test.action, test.pending, action, pending)
+			}
+		})
+	}
+}
+
+func TestDefaultKeysCanBeTyped(t *testing.T) {
+	for action, sequences := range DEFAULT_KEYS {
+		for _, s := range sequences {
+			seq, err := parseSequence(s)
+			if err != nil {
+				t.Fatalf("Got unexpected error for %s: %s", action, err)
+			}
+			if seq[0].Key == tcell.KeyRune && seq[0].Mod == tcell.ModNone {
+				t.Fatalf("Expected %s to start with a modifier or a key that isn't a rune, got %s", action, s)
+			}
+		}
+	}
+}
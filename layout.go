@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	ORIENTATION_HORIZONTAL = "horizontal"
+	ORIENTATION_VERTICAL   = "vertical"
+	DIRECTION_BOTTOM_UP    = "bottom-up"
+	DIRECTION_TOP_DOWN     = "top-down"
+	// SPLIT_STEP is how much grow-list and shrink-list change the split
+	SPLIT_STEP = 0.05
+)
+
+type layoutConfig struct {
+	// Orientation is horizontal for the keys to the left of the secret and
+	// vertical for the keys above or below the secret
+	Orientation string `yaml:"orientation"`
+	// Split is the fraction of the width, or the height if vertical, that
+	// the list of keys takes up
+	Split float64 `yaml:"split"`
+	// SinglePaneWidth is the width below which only one of the list and the
+	// secret is shown at a time, 0 to always show both
+	SinglePaneWidth int `yaml:"single_pane_width"`
+	// Direction is bottom-up for the first key to be closest to the prompt
+	Direction string `yaml:"direction"`
+}
+
+func (l layoutConfig) validate() error {
+	if l.Orientation != ORIENTATION_HORIZONTAL && l.Orientation != ORIENTATION_VERTICAL {
+		return fieldErrorf([]string{"layout", "orientation"}, "layout.orientation must be %s or %s, got %s", ORIENTATION_HORIZONTAL, ORIENTATION_VERTICAL, l.Orientation)
+	}
+	if l.Split < 0.1 || l.Split > 0.9 {
+		return fieldErrorf([]string{"layout", "split"}, "layout.split must be between 0.1 and 0.9, got %g", l.Split)
+	}
+	if l.SinglePaneWidth < 0 {
+		return fieldErrorf([]string{"layout", "single_pane_width"}, "layout.single_pane_width must not be negative")
+	}
+	if l.Direction != DIRECTION_BOTTOM_UP && l.Direction != DIRECTION_TOP_DOWN {
+		return fieldErrorf([]string{"layout", "direction"}, "layout.direction must be %s or %s, got %s", DIRECTION_BOTTOM_UP, DIRECTION_TOP_DOWN, l.Direction)
+	}
+	return nil
+}
+
+type rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+func (r rect) contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height
+}
+
+// screenLayout is where the parts of the ui are drawn. The list keeps its
+// size when it is hidden in single pane mode, so that the view of the keys
+// doesn't change when switching between the panes.
+type screenLayout struct {
+	List          rect
+	ListVisible   bool
+	ScrollbarX    int
+	Detail        rect
+	DetailVisible bool
+	StatsY        int
+	PromptY       int
+}
+
+// layout splits the screen above the stats bar between the list of keys and
+// the secret
+func (u Ui) layout() screenLayout {
+	body := rect{Width: u.Width, Height: max(u.Height-2, 0)}
+	l := screenLayout{StatsY: u.Height - 2, PromptY: u.Height - 1}
+	if u.Layout.SinglePaneWidth > 0 && u.Width < u.Layout.SinglePaneWidth {
+		l.List = rect{Width: body.Width - 1, Height: body.Height}
+		l.ScrollbarX = body.Width - 1
+		l.Detail = rect{X: 2, Width: body.Width - 2, Height: body.Height}
+		l.ListVisible = !u.ShowDetail
+		l.DetailVisible = u.ShowDetail
+		return l
+	}
+	l.ListVisible = true
+	l.DetailVisible = true
+	if u.Layout.Orientation == ORIENTATION_VERTICAL {
+		listHeight := int(float64(body.Height) * u.Layout.Split)
+		detailHeight := max(body.Height-listHeight-1, 0)
+		l.List = rect{Width: body.Width - 1, Height: listHeight}
+		l.Detail = rect{X: 2, Width: body.Width - 2, Height: detailHeight}
+		// The list is next to the prompt when the first key is at the
+		// bottom
+		if u.Layout.Direction == DIRECTION_BOTTOM_UP {
+			l.List.Y = body.Height - listHeight
+		} else {
+			l.Detail.Y = listHeight + 1
+		}
+		l.ScrollbarX = body.Width - 1
+		return l
+	}
+	splitX := int(float64(body.Width) * u.Layout.Split)
+	l.List = rect{Width: splitX, Height: body.Height}
+	l.ScrollbarX = splitX
+	l.Detail = rect{X: splitX + 2, Width: max(body.Width-splitX-2, 0), Height: body.Height}
+	return l
+}
+
+// nKeysToShow is the number of keys that fit in the list
+func (u Ui) nKeysToShow() int {
+	return u.layout().List.Height
+}
+
+// keyY is the row that the key at index i in the view is drawn on
+func (u Ui) keyY(l screenLayout, i int) int {
+	if u.Layout.Direction == DIRECTION_TOP_DOWN {
+		return l.List.Y + i
+	}
+	return l.List.Y + l.List.Height - 1 - i
+}
+
+// keyIndex is the index in the view of the key drawn on row y
+func (u Ui) keyIndex(l screenLayout, y int) int {
+	if u.Layout.Direction == DIRECTION_TOP_DOWN {
+		return y - l.List.Y
+	}
+	return l.List.Y + l.List.Height - 1 - y
+}
+
+// cursorUp moves the cursor up on the screen, which is to the next key when
+// the list goes from the bottom up
+func (u *Ui) cursorUp() command {
+	if u.Layout.Direction == DIRECTION_TOP_DOWN {
+		return u.moveDown()
+	}
+	return u.moveUp()
+}
+
+func (u *Ui) cursorDown() command {
+	if u.Layout.Direction == DIRECTION_TOP_DOWN {
+		return u.moveUp()
+	}
+	return u.moveDown()
+}
+
+// resizeList grows or shrinks the list by SPLIT_STEP
+func (u *Ui) resizeList(step float64) {
+	u.Layout.Split = min(max(u.Layout.Split+step, 0.1), 0.9)
+	u.resetView()
+	u.Message = fmt.Sprintf("Split %.0f%%", u.Layout.Split*100)
+}
+
+// resetView makes the view fit in the list after its size changed
+func (u *Ui) resetView() {
+	u.fit(u.nKeysToShow())
+}
+
+// clippedScreen only draws inside a rect, so that a pane doesn't spill into
+// the one next to it
+type clippedScreen struct {
+	tcell.Screen
+	r rect
+}
+
+func (s clippedScreen) SetContent(x, y int, primary rune, combining []rune, style tcell.Style) {
+	if s.r.contains(x, y) {
+		s.Screen.SetContent(x, y, primary, combining, style)
+	}
+}
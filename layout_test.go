@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestLayout(t *testing.T) {
+	tests := map[string]struct {
+		layout     layoutConfig
+		width      int
+		showDetail bool
+		expected   screenLayout
+	}{
+		"horizontal": {
+			layout: layoutConfig{Orientation: ORIENTATION_HORIZONTAL, Split: 0.5, SinglePaneWidth: 60, Direction: DIRECTION_BOTTOM_UP},
+			width:  100,
+			expected: screenLayout{
+				List: rect{Width: 50, Height: 22}, ListVisible: true, ScrollbarX: 50,
+				Detail: rect{X: 52, Width: 48, Height: 22}, DetailVisible: true,
+				StatsY: 22, PromptY: 23,
+			},
+		},
+		"vertical-bottom-up": {
+			layout: layoutConfig{Orientation: ORIENTATION_VERTICAL, Split: 0.5, Direction: DIRECTION_BOTTOM_UP},
+			width:  100,
+			expected: screenLayout{
+				List: rect{Y: 11, Width: 99, Height: 11}, ListVisible: true, ScrollbarX: 99,
+				Detail: rect{X: 2, Width: 98, Height: 10}, DetailVisible: true,
+				StatsY: 22, PromptY: 23,
+			},
+		},
+		"vertical-top-down": {
+			layout: layoutConfig{Orientation: ORIENTATION_VERTICAL, Split: 0.5, Direction: DIRECTION_TOP_DOWN},
+			width:  100,
+			expected: screenLayout{
+				List: rect{Width: 99, Height: 11}, ListVisible: true, ScrollbarX: 99,
+				Detail: rect{X: 2, Y: 12, Width: 98, Height: 10}, DetailVisible: true,
+				StatsY: 22, PromptY: 23,
+			},
+		},
+		"single-pane-list": {
+			layout: layoutConfig{Orientation: ORIENTATION_HORIZONTAL, Split: 0.5, SinglePaneWidth: 60, Direction: DIRECTION_BOTTOM_UP},
+			width:  50,
+			expected: screenLayout{
+				List: rect{Width: 49, Height: 22}, ListVisible: true, ScrollbarX: 49,
+				Detail: rect{X: 2, Width: 48, Height: 22},
+				StatsY: 22, PromptY: 23,
+			},
+		},
+		"single-pane-detail": {
+			layout:     layoutConfig{Orientation: ORIENTATION_HORIZONTAL, Split: 0.5, SinglePaneWidth: 60, Direction: DIRECTION_BOTTOM_UP},
+			width:      50,
+			showDetail: true,
+			expected: screenLayout{
+				List: rect{Width: 49, Height: 22}, ScrollbarX: 49,
+				Detail: rect{X: 2, Width: 48, Height: 22}, DetailVisible: true,
+				StatsY: 22, PromptY: 23,
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u := Ui{Width: test.width, Height: 24, Layout: test.layout, ShowDetail: test.showDetail}
+			l := u.layout()
+			if l != test.expected {
+				t.Fatalf("Expected %+v, got %+v", test.expected, l)
+			}
+			for i := 0; i < l.List.Height; i++ {
+				if index := u.keyIndex(l, u.keyY(l, i)); index != i {
+					t.Fatalf("Expected key %d to be drawn on a row that maps back to it, got %d", i, index)
+				}
+			}
+		})
+	}
+}
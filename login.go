@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/slarwise/pole/vault"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+var LOGIN_METHODS = []string{"userpass", "ldap", "token"}
+
+type loginField int
+
+const (
+	FIELD_METHOD loginField = iota
+	FIELD_MOUNT
+	FIELD_USERNAME
+	FIELD_PASSWORD
+	FIELD_TOKEN
+	FIELD_SAVE
+)
+
+type loginForm struct {
+	Method   int
+	Mounts   map[string]string
+	Username string
+	Password string
+	Token    string
+	Save     bool
+	Field    int
+	Reason   string
+	Error    string
+}
+
+func (f loginForm) method() string {
+	return LOGIN_METHODS[f.Method]
+}
+
+func (f loginForm) fields() []loginField {
+	if f.method() == "token" {
+		return []loginField{FIELD_METHOD, FIELD_TOKEN, FIELD_SAVE}
+	}
+	return []loginField{FIELD_METHOD, FIELD_MOUNT, FIELD_USERNAME, FIELD_PASSWORD, FIELD_SAVE}
+}
+
+func (f loginForm) field() loginField {
+	return f.fields()[f.Field]
+}
+
+// text returns the text field that is currently selected, or nil if the
+// selected field is not a text field. The mount is stored per method and is
+// handled by edit.
+func (f *loginForm) text() *string {
+	switch f.field() {
+	case FIELD_USERNAME:
+		return &f.Username
+	case FIELD_PASSWORD:
+		return &f.Password
+	case FIELD_TOKEN:
+		return &f.Token
+	}
+	return nil
+}
+
+func (f *loginForm) edit(update func(string) string) {
+	if f.field() == FIELD_MOUNT {
+		f.Mounts[f.method()] = update(f.Mounts[f.method()])
+	} else if text := f.text(); text != nil {
+		*text = update(*text)
+	}
+}
+
+type tokenEvent struct {
+	tcell.EventTime
+	watch  int
+	status TokenStatus
+}
+
+func (ev *tokenEvent) apply(u *Ui) command {
+	if ev.watch == u.tokenWatch {
+		u.Token = ev.status
+	}
+	return nil
+}
+
+// watchEvent has the watcher that keeps a token alive
+type watchEvent struct {
+	tcell.EventTime
+	watch int
+	stop  func()
+}
+
+// watchToken looks up the token and keeps it alive in the background. The
+// status of the token is sent to the event loop so that it can be shown in
+// the stats bar.
+func (u *Ui) watchToken() command {
+	if u.stopTokenWatch != nil {
+		u.stopTokenWatch()
+		u.stopTokenWatch = nil
+	}
+	u.tokenWatch++
+	u.Token = TokenStatus{}
+	store, ok := u.Store.(TokenStore)
+	if !ok {
+		return nil
+	}
+	watch := u.tokenWatch
+	screen := u.Screen
+	return func() tcell.Event {
+		info, err := store.LookupSelf()
+		if err != nil {
+			slog.Error("Failed to look up token", "err", err)
+			return nil
+		}
+		stop := store.WatchToken(info, func(status TokenStatus) {
+			ev := &tokenEvent{watch: watch, status: status}
+			ev.SetEventNow()
+			screen.PostEvent(ev)
+		})
+		return &watchEvent{watch: watch, stop: stop}
+	}
+}
+
+func (ev *watchEvent) apply(u *Ui) command {
+	// The token was replaced while the watcher started
+	if ev.watch != u.tokenWatch {
+		ev.stop()
+		return nil
+	}
+	u.stopTokenWatch = ev.stop
+	return nil
+}
+
+// loginDialog shows a login form for the store of the profile until the user
+// has logged in or gives up by pressing Esc. onLogin is called with a copy of
+// the store that uses the new token, and onCancel, if not nil, when the user
+// gives up.
+type loginDialog struct {
+	form     loginForm
+	profile  string
+	store    TokenStore
+	onLogin  func(u *Ui, store TokenStore) command
+	onCancel func(u *Ui) command
+}
+
+// loginEvent is the outcome of submitting the login form
+type loginEvent struct {
+	tcell.EventTime
+	dialog *loginDialog
+	token  string
+	err    error
+}
+
+func (u *Ui) login(profile string, store TokenStore, reason string, onLogin func(u *Ui, store TokenStore) command, onCancel func(u *Ui) command) {
+	slog.Info("Showing login form", "reason", reason)
+	u.Dialog = &loginDialog{
+		form: loginForm{
+			Mounts: map[string]string{"userpass": "userpass", "ldap": "ldap"},
+			Reason: reason,
+		},
+		profile:  profile,
+		store:    store,
+		onLogin:  onLogin,
+		onCancel: onCancel,
+	}
+}
+
+func (d *loginDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	form := &d.form
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		u.Dialog = nil
+		if d.onCancel != nil {
+			return d.onCancel(u)
+		}
+	case tcell.KeyEnter:
+		form.Error = ""
+		return d.submit(u.Profiles[d.profile].tokenSource())
+	case tcell.KeyTab, tcell.KeyDown, tcell.KeyCtrlN:
+		form.Field = (form.Field + 1) % len(form.fields())
+	case tcell.KeyBacktab, tcell.KeyUp, tcell.KeyCtrlP:
+		form.Field = (form.Field - 1 + len(form.fields())) % len(form.fields())
+	case tcell.KeyLeft, tcell.KeyRight:
+		if form.field() == FIELD_METHOD {
+			step := 1
+			if ev.Key() == tcell.KeyLeft {
+				step = len(LOGIN_METHODS) - 1
+			}
+			form.Method = (form.Method + step) % len(LOGIN_METHODS)
+		}
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		form.edit(func(s string) string {
+			if len(s) == 0 {
+				return s
+			}
+			runes := []rune(s)
+			return string(runes[:len(runes)-1])
+		})
+	case tcell.KeyCtrlU:
+		form.edit(func(string) string { return "" })
+	case tcell.KeyRune:
+		switch form.field() {
+		case FIELD_METHOD:
+			if ev.Rune() == ' ' {
+				form.Method = (form.Method + 1) % len(LOGIN_METHODS)
+			}
+		case FIELD_SAVE:
+			if ev.Rune() == ' ' {
+				form.Save = !form.Save
+			}
+		default:
+			form.edit(func(s string) string { return s + string(ev.Rune()) })
+		}
+	}
+	return nil
+}
+
+// submit logs in with the form and saves the token to the source if the user
+// asked for it
+func (d *loginDialog) submit(source vault.TokenSource) command {
+	form, store := d.form, d.store
+	return func() tcell.Event {
+		token, err := submitLogin(store, form)
+		if err == nil && form.Save {
+			if destination, err := source.Store(token); err != nil {
+				slog.Error("Failed to save token", "destination", destination, "err", err)
+			} else {
+				slog.Info("Saved token", "destination", destination)
+			}
+		}
+		return &loginEvent{dialog: d, token: token, err: err}
+	}
+}
+
+func (ev *loginEvent) apply(u *Ui) command {
+	// The user may have given up while logging in
+	if u.Dialog != dialog(ev.dialog) {
+		return nil
+	}
+	if ev.err != nil {
+		ev.dialog.form.Error = ev.err.Error()
+		return nil
+	}
+	u.Dialog = nil
+	ev.dialog.store.ClearCache()
+	return ev.dialog.onLogin(u, ev.dialog.store.WithToken(ev.token))
+}
+
+func submitLogin(store TokenStore, form loginForm) (string, error) {
+	switch form.method() {
+	case "token":
+		if form.Token == "" {
+			return "", fmt.Errorf("The token must not be empty")
+		}
+		if _, err := store.WithToken(form.Token).LookupSelf(); err != nil {
+			return "", err
+		}
+		return form.Token, nil
+	case "userpass", "ldap":
+		if form.Username == "" {
+			return "", fmt.Errorf("The username must not be empty")
+		}
+		mount := strings.Trim(form.Mounts[form.method()], "/")
+		if form.method() == "ldap" {
+			return store.LoginLDAP(mount, form.Username, form.Password)
+		}
+		return store.LoginUserpass(mount, form.Username, form.Password)
+	}
+	return "", fmt.Errorf("Unknown login method %s", form.method())
+}
+
+func (d *loginDialog) draw(u Ui) {
+	form := d.form
+	u.Screen.HideCursor()
+	x := 2
+	y := 1
+	drawLine(u.Screen, x, y, tcell.StyleDefault.Bold(true), fmt.Sprintf("Log in to %s (%s)", d.store.Address(), d.profile))
+	y++
+	for _, line := range wrap(form.Reason, u.Width-2*x) {
+		drawLine(u.Screen, x, y, STYLE_NULL, line)
+		y++
+	}
+	y++
+	for i, field := range form.fields() {
+		label, value := "", ""
+		switch field {
+		case FIELD_METHOD:
+			label, value = "Method", fmt.Sprintf("< %s >", form.method())
+		case FIELD_MOUNT:
+			label, value = "Mount", form.Mounts[form.method()]
+		case FIELD_USERNAME:
+			label, value = "Username", form.Username
+		case FIELD_PASSWORD:
+			label, value = "Password", strings.Repeat("*", len([]rune(form.Password)))
+		case FIELD_TOKEN:
+			label, value = "Token", strings.Repeat("*", len([]rune(form.Token)))
+		case FIELD_SAVE:
+			label, value = "Save token", "[ ]"
+			if form.Save {
+				value = "[x]"
+			}
+		}
+		style := STYLE_DEFAULT
+		if i == form.Field {
+			drawLine(u.Screen, x, y, STYLE_CURSOR, " ")
+			style = STYLE_SELECTED
+		}
+		drawLine(u.Screen, x+2, y, STYLE_KEY, fmt.Sprintf("%-11s", label))
+		drawLine(u.Screen, x+14, y, style, value)
+		y++
+	}
+	y++
+	for _, line := range wrap(form.Error, u.Width-2*x) {
+		drawLine(u.Screen, x, y, STYLE_ERROR, line)
+		y++
+	}
+	helpStr := "Next field <Tab> Change ←→/<Space> Log in <Enter> Exit <Esc>"
+	drawLine(u.Screen, x, u.Height-1, STYLE_HELP, helpStr)
+}
+
+// wrap splits s into lines that are at most width runes long
+func wrap(s string, width int) []string {
+	if width < 1 || s == "" {
+		return nil
+	}
+	lines := []string{}
+	runes := []rune(s)
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(lines, string(runes))
+}
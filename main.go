@@ -1,54 +1,99 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"reflect"
 	"slices"
 	"strings"
-
-	"github.com/slarwise/pole/internal/vault"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
 )
 
-func mustGetEnv(name string) string {
-	value, found := os.LookupEnv(name)
-	if !found {
-		fatal(fmt.Sprintf("Environment variable %s must be set", name))
-	}
-	return value
-}
-
+// fatal logs to stderr even if logging has been disabled, and exits
 func fatal(msg string, args ...any) {
-	slog.Error(msg, args...)
+	slog.New(slog.NewTextHandler(os.Stderr, nil)).Error(msg, args...)
 	os.Exit(1)
 }
 
 type Ui struct {
-	Screen       tcell.Screen
-	Keys         []string
-	FilteredKeys []string
-	Secret       vault.Secret
-	Prompt       string
-	ViewStart    int
-	ViewEnd      int
-	Cursor       int
+	Screen tcell.Screen
+	model
+	Report     Report
+	ShowReport bool
+	Secret     Secret
+	// Capabilities of the token on the secret, nil if unknown
+	Capabilities *Capabilities
+	// Diff is shown instead of the secret until another key is selected
+	Diff *secretDiff
+	// Drift is shown instead of the secret until it is toggled off
+	Drift *driftReport
+	// RevealDiff shows the values in the diff instead of masking them
+	RevealDiff bool
+	// History has the earlier queries, oldest first
+	History []string
+	// Pasting is true between the start and end of a bracketed paste, the
+	// pasted text is collected and inserted in the prompt when it ends
+	Pasting bool
+	pasted  []rune
+	// mouseButtons are the buttons that were held at the last mouse event,
+	// to tell presses from drags
+	mouseButtons tcell.ButtonMask
 	Width        int
 	Height       int
 	Result       []byte
-	Vault        vault.Client
+	Store        SecretStore
 	Mounts       []string
 	CurrentMount int
 	ShowHelp     bool
+	// DefaultMount is the mount to start on for profiles that don't have
+	// their own
+	DefaultMount string
+	Layout       layoutConfig
+	// ShowDetail is true when the secret is shown instead of the list in
+	// single pane mode
+	ShowDetail bool
+	Keymap     keymap
+	// PendingKeys is the beginning of a key sequence that is being typed
+	PendingKeys []keyPress
+	// Field is the index of the selected field in the data of the secret
+	Field    int
+	Token    TokenStatus
+	Profiles map[string]Profile
+	Profile  string
+	// Error and Message are shown in the stats bar until the next key press
+	Error   string
+	Message string
+	// Busy is what pole is waiting for, shown in place of the stats
+	Busy string
+	// Dialog is drawn instead of the keys and gets the key presses while it
+	// is open
+	Dialog dialog
+	// Quit makes pole exit after the event, with QuitErr if it is set
+	Quit          bool
+	QuitErr       error
+	profileStates map[string]*profileState
+	// tokenWatch identifies the current token watcher, so that status
+	// updates about replaced tokens can be ignored
+	tokenWatch     int
+	stopTokenWatch func()
 }
 
-func newUi(vaultClient vault.Client, mounts []string) (Ui, error) {
+func newUi(profiles map[string]Profile, config Config) (Ui, error) {
+	keys, err := newKeymap(config.Keys)
+	if err != nil {
+		return Ui{}, err
+	}
 	screen, err := tcell.NewScreen()
 	if err != nil {
 		return Ui{}, fmt.Errorf("Failed to create a terminal screen: %s", err)
@@ -56,49 +101,117 @@ func newUi(vaultClient vault.Client, mounts []string) (Ui, error) {
 	if err := screen.Init(); err != nil {
 		return Ui{}, fmt.Errorf("Failed to initialize terminal screen: %s", err)
 	}
+	history, err := loadHistory(historyPath())
+	if err != nil {
+		slog.Error("Failed to load query history", "err", err)
+	}
 	screen.EnablePaste()
+	if config.Mouse {
+		screen.EnableMouse()
+	}
 	screen.Clear()
 	width, height := screen.Size()
 	return Ui{
-		Vault:        vaultClient,
-		Mounts:       mounts,
-		CurrentMount: 0,
-		ShowHelp:     true,
-		Screen:       screen,
-		Width:        width,
-		Height:       height,
+		Profiles:      profiles,
+		profileStates: make(map[string]*profileState),
+		CurrentMount:  0,
+		ShowHelp:      config.ShowHelp,
+		DefaultMount:  config.DefaultMount,
+		Layout:        config.Layout,
+		Keymap:        keys,
+		History:       history,
+		Screen:        screen,
+		Width:         width,
+		Height:        height,
 	}, nil
 }
 
-const (
-	SCROLL_OFF = 4
-)
+// SCROLL_OFF is the number of keys to keep between the cursor and the edge
+// of the list when scrolling
+var SCROLL_OFF = DEFAULT_CONFIG.ScrollOff
 
+// The styles are set from the theme in the config
 var (
-	STYLE_KEY     = tcell.StyleDefault.Foreground(tcell.ColorBlue)
-	STYLE_STRING  = tcell.StyleDefault.Foreground(tcell.ColorGreen)
-	STYLE_NULL    = tcell.StyleDefault.Foreground(tcell.ColorGray)
-	STYLE_DEFAULT = tcell.StyleDefault
+	STYLE_KEY       = tcell.StyleDefault.Foreground(tcell.ColorBlue)
+	STYLE_STRING    = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	STYLE_NULL      = tcell.StyleDefault.Foreground(tcell.ColorGray)
+	STYLE_DEFAULT   = tcell.StyleDefault
+	STYLE_STATS     = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	STYLE_ERROR     = tcell.StyleDefault.Foreground(tcell.ColorRed)
+	STYLE_HELP      = tcell.StyleDefault.Foreground(tcell.ColorRed)
+	STYLE_CURSOR    = tcell.StyleDefault.Background(tcell.ColorRed)
+	STYLE_SELECTED  = tcell.StyleDefault.Background(tcell.ColorBlack)
+	STYLE_SCROLLBAR = tcell.StyleDefault.Foreground(tcell.ColorGray)
 )
 
 func main() {
 	log.SetFlags(0) // Disable the timestamp
-	vaultClient := vault.Client{
-		Addr:  mustGetEnv("VAULT_ADDR"),
-		Token: mustGetEnv("VAULT_TOKEN"),
+	auth := authConfig{}
+	auth.registerFlags(flag.CommandLine)
+	profileName := flag.String("profile", os.Getenv("POLE_PROFILE"), "`name` of the profile in the config file to use ($POLE_PROFILE)")
+	demo := flag.Bool("demo", false, "browse made up secrets in an in-memory vault instead of a real one")
+	flag.Usage = usage
+	flag.Parse()
+	config, err := loadConfig(configPath())
+	if err != nil {
+		fatal(err.Error())
+	}
+	profiles := config.profiles()
+	if *demo {
+		server, profile := startDemo()
+		defer server.Close()
+		profiles = map[string]Profile{DEMO_PROFILE: profile}
+		*profileName = DEMO_PROFILE
+	} else {
+		*profileName, err = config.selectProfile(*profileName)
+		if err != nil {
+			fatal(err.Error())
+		}
 	}
-	mounts := []string{}
-	mounts = vaultClient.GetMounts()
+	profile := profiles[*profileName]
+	profile.Auth = auth.overrides(profile.Auth)
+	profiles[*profileName] = profile
 	if len(os.Getenv("DEBUG")) > 0 {
 		logFile, err := os.Create("./log")
 		if err != nil {
 			fatal("Failed to create log file", "err", err)
 		}
-		slog.SetDefault(slog.New(slog.NewTextHandler(logFile, nil)))
+		slog.SetDefault(slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelDebug})))
 	} else {
 		log.SetOutput(io.Discard)
 	}
-	ui, err := newUi(vaultClient, mounts)
+	if flag.Arg(0) == "sync" {
+		// sync connects to the profiles in its arguments instead
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := syncCommand(ctx, profiles, flag.Args()[1:]); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+	if flag.NArg() > 0 {
+		vaultClient, err := profile.client()
+		if err != nil {
+			fatal("Failed to create vault client", "profile", *profileName, "err", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		token, tokenSource, err := profile.token(ctx, vaultClient)
+		if err != nil {
+			fatal("Failed to get a vault token", "profile", *profileName, "source", tokenSource, "err", err)
+		}
+		vaultClient.Token = token
+		if err := runCommand(ctx, vaultClient, flag.Args()); err != nil {
+			if errors.Is(err, errSecretsDiffer) {
+				os.Exit(1)
+			}
+			fatal(err.Error())
+		}
+		return
+	}
+	SCROLL_OFF = config.ScrollOff
+	config.Theme.apply()
+	ui, err := newUi(profiles, config)
 	if err != nil {
 		fatal("Failed to initialize UI", "err", err)
 	}
@@ -107,6 +220,7 @@ func main() {
 		// re-raise them - otherwise your application can
 		// die without leaving any diagnostic trace.
 		errorMsg := recover()
+		ui.saveQuery()
 		ui.Screen.Fini()
 		if errorMsg != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errorMsg)
@@ -115,141 +229,194 @@ func main() {
 		}
 	}
 	defer quit()
-	ui.drawPrompt()
-	drawLoadingScreen(ui)
-	ui.Screen.Show()
-	ui.Keys = vaultClient.GetKeys(ui.Mounts[ui.CurrentMount])
-	ui.newKeysView()
-	ui.Redraw()
+	cmd := ui.switchProfile(*profileName)
+	// Filtered once the keys have been loaded
+	ui.Prompt.set(config.InitialQuery)
 	for {
+		if ui.Quit {
+			if ui.QuitErr != nil {
+				// Like a cancelled login, which must exit with 1 and not as
+				// a panic
+				ui.Screen.Fini()
+				fatal(ui.QuitErr.Error())
+			}
+			return
+		}
+		ui.Redraw()
+		if cmd != nil {
+			go func(screen tcell.Screen, cmd command) {
+				if ev := cmd(); ev != nil {
+					screen.PostEventWait(ev)
+				}
+			}(ui.Screen, cmd)
+		}
 		ev := ui.Screen.PollEvent()
 		slog.Info("event", "ev", fmt.Sprintf("%T", ev))
-		switch ev := ev.(type) {
-		case *tcell.EventResize:
+		if _, ok := ev.(*tcell.EventResize); ok {
 			ui.Screen.Sync()
-			ui.Width, ui.Height = ui.Screen.Size()
-			ui.ViewEnd = min(nKeysToShow(ui.Height), len(ui.FilteredKeys))
-			if ui.ViewStart+ui.Cursor >= ui.ViewEnd {
-				ui.Cursor = 0
-				ui.ViewStart = 0
-			}
-		case *tcell.EventKey:
-			switch ev.Key() {
-			case tcell.KeyEscape, tcell.KeyCtrlC:
-				return
-			case tcell.KeyEnter:
-				if !(reflect.ValueOf(ui.Secret).IsZero()) {
-					bytes, err := json.MarshalIndent(ui.Secret, "", "  ")
-					if err != nil {
-						panic(fmt.Sprintf("Failed to marshal secret: %s", err))
-					}
-					ui.Result = bytes
-				}
-				return
-			case tcell.KeyCtrlO:
-				ui.openInBrowser()
-			case tcell.KeyBackspace, tcell.KeyBackspace2:
-				if len(ui.Prompt) > 0 {
-					ui.Prompt = ui.Prompt[:len(ui.Prompt)-1]
-					ui.newKeysView()
-				}
-			case tcell.KeyCtrlU:
-				ui.Prompt = ""
-				ui.newKeysView()
-			case tcell.KeyRune:
-				switch ev.Rune() {
-				case '?':
-					ui.ShowHelp = !ui.ShowHelp
-				case ',':
-					ui.nextMount()
-				case ';':
-					ui.previousMount()
-				default:
-					ui.Prompt += string(ev.Rune())
-					ui.newKeysView()
-				}
-			case tcell.KeyLeft:
-				ui.nextMount()
-			case tcell.KeyRight:
-				ui.previousMount()
-			case tcell.KeyCtrlK, tcell.KeyCtrlP, tcell.KeyUp:
-				ui.moveUp()
-			case tcell.KeyCtrlJ, tcell.KeyCtrlN, tcell.KeyDown:
-				ui.moveDown()
-				// TODO: Add key for refreshing the secrets
-			}
 		}
-
-		ui.Redraw()
+		cmd = ui.update(ev)
 	}
 }
 
 func (u Ui) Redraw() {
 	u.Screen.Clear()
-	u.drawKeys()
-	u.drawScrollbar()
+	if u.Dialog != nil {
+		u.Dialog.draw(u)
+		u.Screen.Show()
+		return
+	}
+	l := u.layout()
+	if l.ListVisible {
+		u.drawKeys(l)
+		u.drawScrollbar(l)
+	}
 	u.drawStats()
 	u.drawHelp()
 	u.drawPrompt()
-	u.drawSecret()
+	if l.DetailVisible {
+		if u.ShowReport {
+			u.drawReport(l.Detail)
+		} else if u.Diff != nil {
+			u.drawDiff(l.Detail)
+		} else if u.Drift != nil {
+			u.drawDrift(l.Detail)
+		} else {
+			u.drawSecret(l.Detail)
+		}
+	}
 	u.Screen.Show()
 }
 
-func drawLine(s tcell.Screen, x, y int, style tcell.Style, text string) {
-	for _, r := range []rune(text) {
-		s.SetContent(x, y, r, nil, style)
-		x++
+// drawLine draws the text from column x and returns the column after it.
+// Wide characters take up two cells, and combining characters are drawn in
+// the cell of the character before them.
+func drawLine(s tcell.Screen, x, y int, style tcell.Style, text string) int {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		width := runewidth.RuneWidth(runes[i])
+		if width == 0 {
+			// A combining character without a character before it
+			continue
+		}
+		combining := []rune{}
+		for i+1 < len(runes) && runewidth.RuneWidth(runes[i+1]) == 0 {
+			combining = append(combining, runes[i+1])
+			i++
+		}
+		s.SetContent(x, y, runes[i-len(combining)], combining, style)
+		x += width
 	}
+	return x
 }
 
-func (u Ui) drawKeys() {
-	yBottom := nKeysToShow(u.Height) - 1
-	maxLength := u.Width/2 - 2
-	for i, key := range u.FilteredKeys[u.ViewStart:u.ViewEnd] {
-		keyToDraw := key
-		if len(keyToDraw) > maxLength {
-			keyToDraw = fmt.Sprintf("%s..", key[:maxLength-2])
-		}
-		y := yBottom - i
+// textWidth is the number of cells that drawLine uses for the text
+func textWidth(text string) int {
+	return runewidth.StringWidth(text)
+}
+
+// truncate shortens the text to fit in width cells, ending it with an
+// ellipsis if it was too long
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(text, width, "…")
+}
+
+func (u Ui) drawKeys(l screenLayout) {
+	maxLength := l.List.Width - 2
+	for i, key := range u.inView() {
+		keyToDraw := truncate(key, maxLength)
+		y := u.keyY(l, i)
 		if i == u.Cursor {
-			drawLine(u.Screen, 0, y, tcell.StyleDefault.Background(tcell.ColorRed), " ")
-			drawLine(u.Screen, 1, y, tcell.StyleDefault.Background(tcell.ColorBlack), " ")
-			drawLine(u.Screen, 2, y, tcell.StyleDefault.Background(tcell.ColorBlack), keyToDraw)
+			drawLine(u.Screen, 0, y, STYLE_CURSOR, " ")
+			drawLine(u.Screen, 1, y, STYLE_SELECTED, " ")
+			drawLine(u.Screen, 2, y, STYLE_SELECTED, keyToDraw)
 		} else {
-			drawLine(u.Screen, 2, y, tcell.StyleDefault, keyToDraw)
+			drawLine(u.Screen, 2, y, STYLE_DEFAULT, keyToDraw)
 		}
 	}
 }
 
-func (u Ui) drawScrollbar() {
-	if len(u.FilteredKeys) <= nKeysToShow(u.Height) {
+func (u Ui) drawScrollbar(l screenLayout) {
+	if len(u.FilteredKeys) <= l.List.Height {
 		return
 	}
-	fullHeight := float32(nKeysToShow(u.Height) - 1)
+	fullHeight := float32(l.List.Height - 1)
 	nKeys := float32(len(u.FilteredKeys))
 	normieStartY := float32(u.ViewStart) / nKeys
 	normieH := fullHeight / nKeys
 	normieEndY := normieStartY + normieH
 	startY := int(normieStartY * fullHeight)
 	endY := int(normieEndY*fullHeight) + 1
-	x := u.Width / 2
-	for y := startY; y <= endY; y++ {
-		invertedY := int(fullHeight) - y
-		u.Screen.SetContent(x, invertedY, '│', nil, tcell.StyleDefault.Foreground(tcell.ColorGray))
+	for y := startY; y <= min(endY, int(fullHeight)); y++ {
+		u.Screen.SetContent(l.ScrollbarX, u.keyY(l, y), '│', nil, STYLE_SCROLLBAR)
 	}
 }
 
-func (u Ui) drawSecret() {
+func (u Ui) drawSecret(r rect) {
 	if reflect.ValueOf(u.Secret).IsZero() {
 		return
 	}
-	x := u.Width/2 + 2
-	y := 0
-	drawData(u.Screen, x, &y, "data", u.Secret.Data.Data)
-	drawData(u.Screen, x, &y, "metadata", u.Secret.Data.Metadata)
+	s := clippedScreen{u.Screen, r}
+	x := r.X
+	y := r.Y
+	selected := ""
+	if fields := u.fields(); len(fields) > 0 {
+		selected = fields[u.Field]
+	}
+	drawData(s, x, &y, "data", u.Secret.Data, selected)
+	drawData(s, x, &y, "metadata", u.Secret.Metadata, "")
+	if u.Capabilities != nil {
+		drawCapabilities(s, x, &y, *u.Capabilities)
+	}
 }
 
-func drawData(s tcell.Screen, x int, y *int, name string, data map[string]interface{}) {
+// drawCapabilities shows which operations the token can perform on the
+// secret, the ones it can't perform are grayed out
+func drawCapabilities(s tcell.Screen, x int, y *int, capabilities Capabilities) {
+	kToDraw := "capabilities: "
+	drawLine(s, x, *y, STYLE_KEY, kToDraw)
+	vStart := x + textWidth(kToDraw)
+	for _, op := range capabilities.Operations() {
+		style := STYLE_STRING
+		if !op.Allowed {
+			style = STYLE_NULL.StrikeThrough(true)
+		}
+		drawLine(s, vStart, *y, style, op.Name)
+		vStart += textWidth(op.Name) + 1
+	}
+	*y++
+}
+
+// drawReport lists the directories in the current mount that could not be
+// listed, in place of the secret
+func (u Ui) drawReport(r rect) {
+	s := clippedScreen{u.Screen, r}
+	x := r.X
+	y := r.Y
+	if len(u.Report) == 0 {
+		drawLine(s, x, y, STYLE_NULL, "All paths are readable")
+		return
+	}
+	drawLine(s, x, y, STYLE_KEY, fmt.Sprintf("%d paths not readable in %s:", len(u.Report), u.Mounts[u.CurrentMount]))
+	y++
+	for _, unreadable := range u.Report {
+		if y >= r.Y+r.Height {
+			break
+		}
+		drawLine(s, x+2, y, STYLE_ERROR, unreadable.Reason)
+		drawLine(s, x+12, y, STYLE_STRING, unreadable.Path)
+		y++
+		drawLine(s, x+12, y, STYLE_NULL, unreadable.Err)
+		y++
+	}
+}
+
+// drawData draws the keys and values in data, with a cursor next to the
+// selected key
+func drawData(s tcell.Screen, x int, y *int, name string, data map[string]interface{}, selected string) {
 	keys := []string{}
 	for k := range data {
 		keys = append(keys, k)
@@ -260,8 +427,11 @@ func drawData(s tcell.Screen, x int, y *int, name string, data map[string]interf
 	*y++
 	for _, k := range keys {
 		kToDraw := fmt.Sprintf(`%s: `, k)
+		if k == selected {
+			drawLine(s, x, *y, STYLE_CURSOR, " ")
+		}
 		drawLine(s, x+2, *y, STYLE_KEY, kToDraw)
-		vStart := x + 2 + len(kToDraw)
+		vStart := x + 2 + textWidth(kToDraw)
 		v := data[k]
 		switch vForReal := v.(type) {
 		case string:
@@ -270,6 +440,7 @@ func drawData(s tcell.Screen, x int, y *int, name string, data map[string]interf
 		case []interface{}:
 			if len(vForReal) == 0 {
 				drawLine(s, vStart, *y, STYLE_DEFAULT, "[]")
+				*y++
 			} else {
 				*y++
 				for _, e := range vForReal {
@@ -279,144 +450,151 @@ func drawData(s tcell.Screen, x int, y *int, name string, data map[string]interf
 				}
 			}
 		case nil:
-			drawLine(s, vStart, *y, tcell.StyleDefault.Foreground(tcell.ColorGray), "null")
+			drawLine(s, vStart, *y, STYLE_NULL, "null")
 			*y++
 		default:
-			drawLine(s, vStart, *y, tcell.StyleDefault, fmt.Sprintf("%v", vForReal))
+			drawLine(s, vStart, *y, STYLE_DEFAULT, fmt.Sprintf("%v", vForReal))
 			*y++
 		}
 	}
 }
 
-func (u Ui) drawStats() {
-	nKeysStr := fmt.Sprint(len(u.Keys))
-	drawLine(u.Screen, 2, u.Height-2, tcell.StyleDefault.Foreground(tcell.ColorYellow), nKeysStr)
-	mountsStr := ""
-	for i, m := range u.Mounts {
-		if i == u.CurrentMount {
-			mountsStr = fmt.Sprintf("%s [%s]", mountsStr, m)
-		} else {
-			mountsStr = fmt.Sprintf("%s  %s ", mountsStr, m)
-		}
+// dataHeight is the number of rows that drawData uses for the value
+func dataHeight(v interface{}) int {
+	if list, ok := v.([]interface{}); ok && len(list) > 0 {
+		return len(list) + 1
 	}
-	drawLine(u.Screen, 4, u.Height-2, tcell.StyleDefault.Foreground(tcell.ColorYellow), mountsStr)
+	return 1
 }
 
-func (u Ui) drawHelp() {
-	if !u.ShowHelp {
+func (u Ui) drawStats() {
+	y := u.Height - 2
+	x := 2
+	if u.Busy != "" {
+		drawLine(u.Screen, x, y, STYLE_STATS, u.Busy)
 		return
 	}
-	helpStr := "Move ↑↓ Change mount ←→ Exit <Esc>"
-	drawLine(u.Screen, u.Width/2-len(helpStr)/2+4, u.Height-1, tcell.StyleDefault.Foreground(tcell.ColorRed), helpStr)
-}
-
-func (u Ui) drawPrompt() {
-	drawLine(u.Screen, 0, u.Height-1, tcell.StyleDefault.Bold(true), ">")
-	drawLine(u.Screen, 2, u.Height-1, tcell.StyleDefault, u.Prompt)
-}
-
-func drawLoadingScreen(u Ui) {
-	drawLine(u.Screen, 2, u.Height-2, tcell.StyleDefault.Foreground(tcell.ColorYellow), fmt.Sprintf("%-*s", u.Width-2, "Loading..."))
+	if u.showProfile() {
+		profileStr := fmt.Sprintf(" %s ", u.Profile)
+		drawLine(u.Screen, x, y, profileStyle(u.Profiles[u.Profile]), profileStr)
+		x += textWidth(profileStr) + 1
+	}
+	nKeysStr := fmt.Sprint(len(u.Keys))
+	drawLine(u.Screen, x, y, STYLE_STATS, nKeysStr)
+	x += len(nKeysStr) + 1
+	for _, span := range u.mountSpans() {
+		drawLine(u.Screen, span.Start, y, STYLE_STATS, span.Text)
+		x = span.End
+	}
+	x += 2
+	if len(u.PendingKeys) > 0 {
+		pendingStr := sequenceName(u.PendingKeys) + " -"
+		drawLine(u.Screen, x, y, STYLE_STATS, pendingStr)
+		x += textWidth(pendingStr) + 2
+	}
+	if u.Error != "" {
+		drawLine(u.Screen, x, y, STYLE_ERROR, u.Error)
+		x += textWidth(u.Error)
+	} else if u.Message != "" {
+		drawLine(u.Screen, x, y, STYLE_STRING, u.Message)
+		x += textWidth(u.Message)
+	} else if len(u.Report) > 0 {
+		reportStr := fmt.Sprintf("%d paths not readable %s", len(u.Report), u.Keymap.keyHint("toggle-report"))
+		drawLine(u.Screen, x, y, STYLE_ERROR, reportStr)
+		x += textWidth(reportStr)
+	}
+	u.drawToken(x + 1)
 }
 
-func nKeysToShow(windowHeight int) int {
-	return windowHeight - 2
+// showProfile is false when the only profile is the one configured by
+// VAULT_ADDR, then there is no need to show its name
+func (u Ui) showProfile() bool {
+	return u.Profile != ENV_PROFILE || len(u.Profiles) > 1
 }
 
-type Match struct {
-	Key                string
-	ConsecutiveMatches int
+// mountSpan is where a mount is drawn in the stats bar, Start is inclusive
+// and End exclusive
+type mountSpan struct {
+	Start int
+	End   int
+	Text  string
 }
 
-func (u *Ui) newKeysView() {
-	matches := []Match{}
-	for _, k := range u.Keys {
-		if match, consecutive := matchesPrompt(u.Prompt, k); match {
-			matches = append(matches, Match{Key: k, ConsecutiveMatches: consecutive})
-		}
+// mountSpans are the positions of the mounts in the stats bar, after the
+// profile and the number of keys
+func (u Ui) mountSpans() []mountSpan {
+	x := 2
+	if u.showProfile() {
+		x += textWidth(fmt.Sprintf(" %s ", u.Profile)) + 1
 	}
-	slices.SortFunc(matches, func(a, b Match) int {
-		return b.ConsecutiveMatches - a.ConsecutiveMatches
-	})
-	u.FilteredKeys = []string{}
-	for _, m := range matches {
-		u.FilteredKeys = append(u.FilteredKeys, m.Key)
-	}
-	u.ViewStart = 0
-	u.ViewEnd = min(nKeysToShow(u.Height), len(u.FilteredKeys))
-	if len(u.FilteredKeys) == 0 {
-		u.Cursor = 0
-	} else {
-		u.Cursor = min(u.Cursor, len(u.FilteredKeys)-1)
+	x += len(fmt.Sprint(len(u.Keys))) + 1
+	spans := []mountSpan{}
+	for i, m := range u.Mounts {
+		text := fmt.Sprintf("  %s ", m)
+		if i == u.CurrentMount {
+			text = fmt.Sprintf(" [%s]", m)
+		}
+		end := x + textWidth(text)
+		spans = append(spans, mountSpan{Start: x, End: end, Text: text})
+		x = end
 	}
-	u.setSecret()
+	return spans
 }
 
-func (u *Ui) setSecret() {
-	if len(u.FilteredKeys) > 0 {
-		u.Secret = u.Vault.GetSecret(u.Mounts[u.CurrentMount], u.FilteredKeys[u.ViewStart+u.Cursor])
-	} else {
-		u.Secret = vault.Secret{}
+// drawToken shows who the token belongs to and when it expires at the right
+// end of the stats bar, if there is room for it after minX
+func (u Ui) drawToken(minX int) {
+	if u.Token.Info.DisplayName == "" {
+		return
 	}
-}
-
-func (u *Ui) moveUp() {
-	if u.ViewStart+u.Cursor+1 < len(u.FilteredKeys) {
-		if u.Cursor+1 >= nKeysToShow(u.Height)-SCROLL_OFF && u.ViewEnd < len(u.FilteredKeys) {
-			u.ViewStart++
-			u.ViewEnd++
-		} else {
-			u.Cursor++
+	style := STYLE_NULL
+	var tokenStr string
+	if u.Token.Warning != "" {
+		style = STYLE_ERROR
+		tokenStr = u.Token.Warning
+	} else {
+		ttl := "no expiry"
+		if !u.Token.Expires.IsZero() {
+			ttl = u.Token.Remaining().Round(time.Second).String()
 		}
+		tokenStr = fmt.Sprintf("%s [%s] %s", u.Token.Info.DisplayName, strings.Join(u.Token.Info.Policies, ","), ttl)
 	}
-	u.setSecret()
-}
-
-func (u *Ui) moveDown() {
-	if u.Cursor > 0 {
-		if u.Cursor-1 < SCROLL_OFF && u.ViewStart > 0 {
-			u.ViewStart--
-			u.ViewEnd--
-		} else {
-			u.Cursor--
-		}
+	x := u.Width - textWidth(tokenStr) - 1
+	if x < minX {
+		return
 	}
-	u.setSecret()
+	drawLine(u.Screen, x, u.Height-2, style, tokenStr)
 }
 
-func (u *Ui) nextMount() {
-	if len(u.Mounts) < 2 {
+func (u Ui) drawHelp() {
+	if !u.ShowHelp {
 		return
 	}
-	if u.CurrentMount == 0 {
-		u.CurrentMount = len(u.Mounts) - 1
-	} else {
-		u.CurrentMount--
+	helpStr := u.helpLine()
+	width := textWidth(helpStr)
+	x := (u.Width - width) / 2
+	// The help is moved right of the prompt, or left out on narrow screens
+	x = max(x, 2+textWidth(u.Prompt.String())+2)
+	if x+width > u.Width {
+		return
 	}
-	drawLoadingScreen(*u)
-	u.Screen.Show()
-	u.Keys = u.Vault.GetKeys(u.Mounts[u.CurrentMount])
-	u.Prompt = ""
-	u.newKeysView()
+	drawLine(u.Screen, x, u.Height-1, STYLE_HELP, helpStr)
 }
 
-func (u *Ui) previousMount() {
-	if len(u.Mounts) < 2 {
-		return
-	}
-	u.CurrentMount = (u.CurrentMount + 1) % len(u.Mounts)
-	drawLoadingScreen(*u)
-	u.Screen.Show()
-	u.Keys = u.Vault.GetKeys(u.Mounts[u.CurrentMount])
-	u.Prompt = ""
-	u.newKeysView()
+func (u Ui) drawPrompt() {
+	drawLine(u.Screen, 0, u.Height-1, tcell.StyleDefault.Bold(true), ">")
+	drawLine(u.Screen, 2, u.Height-1, STYLE_DEFAULT, u.Prompt.String())
+	u.Screen.ShowCursor(2+textWidth(string(u.Prompt.Text[:u.Prompt.Cursor])), u.Height-1)
 }
 
-func (u *Ui) openInBrowser() {
+func (u *Ui) openInBrowser() command {
 	url := u.Secret.Url
-	cmd := exec.Command("open", url)
-	if err := cmd.Run(); err != nil {
-		slog.Error("Failed to open secret in browser", "err", err, "url", url)
+	return func() tcell.Event {
+		cmd := exec.Command("open", url)
+		if err := cmd.Run(); err != nil {
+			slog.Error("Failed to open secret in browser", "err", err, "url", url)
+		}
+		return nil
 	}
 }
 
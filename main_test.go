@@ -1,6 +1,13 @@
 package main
 
-import "testing"
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
 
 func TestMatchesPrompt(t *testing.T) {
 	tests := map[string]struct {
@@ -76,3 +83,127 @@ func TestMatchesPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestMountSpans(t *testing.T) {
+	u := Ui{
+		model:        model{Keys: []string{"/a", "/b"}},
+		Mounts:       []string{"kv", "secret"},
+		CurrentMount: 1,
+		Profile:      "prod",
+		Profiles:     map[string]Profile{"prod": {}},
+	}
+	spans := u.mountSpans()
+	expected := []mountSpan{
+		{Start: 11, End: 16, Text: "  kv "},
+		{Start: 16, End: 25, Text: " [secret]"},
+	}
+	if !slices.Equal(spans, expected) {
+		t.Fatalf("Expected %v, got %v", expected, spans)
+	}
+}
+
+func newTestScreen(t *testing.T, width, height int) tcell.SimulationScreen {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to initialize simulation screen: %s", err)
+	}
+	screen.SetSize(width, height)
+	t.Cleanup(screen.Fini)
+	return screen
+}
+
+// screenRow is the text on the row, with the cells that are covered by wide
+// characters left out
+func screenRow(screen tcell.SimulationScreen, y int) string {
+	screen.Show()
+	cells, width, _ := screen.GetContents()
+	row := ""
+	for x := 0; x < width; {
+		runes := cells[y*width+x].Runes
+		if len(runes) == 0 {
+			row += " "
+			x++
+			continue
+		}
+		row += string(runes)
+		x += max(runewidth.RuneWidth(runes[0]), 1)
+	}
+	return strings.TrimRight(row, " ")
+}
+
+func TestDrawLine(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		end  int
+		row  string
+	}{
+		"ascii":       {text: "abc", end: 3, row: "abc"},
+		"wide":        {text: "密码", end: 4, row: "密码"},
+		"emoji":       {text: "🔑x", end: 3, row: "🔑x"},
+		"combining":   {text: "éx", end: 2, row: "éx"},
+		"lone-accent": {text: "́x", end: 1, row: "x"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			screen := newTestScreen(t, 10, 1)
+			end := drawLine(screen, 0, 0, STYLE_DEFAULT, test.text)
+			if end != test.end {
+				t.Fatalf("Expected the text to end at %d, got %d", test.end, end)
+			}
+			if row := screenRow(screen, 0); row != test.row {
+				t.Fatalf("Expected row %q, got %q", test.row, row)
+			}
+		})
+	}
+}
+
+func TestDrawKeysTruncates(t *testing.T) {
+	tests := map[string]struct {
+		key string
+		row string
+	}{
+		"short":     {key: "/db", row: "  /db"},
+		"ascii":     {key: "/database/production", row: "  /database/pro…"},
+		"wide":      {key: "/密码/数据库/生产环境", row: "  /密码/数据库/…"},
+		"wide-edge": {key: "/密码密码密码密码", row: "  /密码密码密码…"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			screen := newTestScreen(t, 32, 4)
+			layout := DEFAULT_CONFIG.Layout
+			layout.SinglePaneWidth = 0
+			u := Ui{
+				Screen: screen,
+				Width:  32,
+				Height: 4,
+				Layout: layout,
+				model:  model{FilteredKeys: []string{test.key}, ViewEnd: 1, Cursor: 1},
+			}
+			l := u.layout()
+			u.drawKeys(l)
+			row := screenRow(screen, u.keyY(l, 0))
+			if row != test.row {
+				t.Fatalf("Expected row %q, got %q", test.row, row)
+			}
+			if textWidth(row) > l.List.Width {
+				t.Fatalf("Expected the key to fit in %d cells, it takes %d", l.List.Width, textWidth(row))
+			}
+		})
+	}
+}
+
+func TestDrawHelpCentred(t *testing.T) {
+	keymap, err := newKeymap(nil)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	screen := newTestScreen(t, 120, 4)
+	u := Ui{Screen: screen, Width: 120, Height: 4, ShowHelp: true, Keymap: keymap}
+	u.drawHelp()
+	row := screenRow(screen, 3)
+	helpStr := u.helpLine()
+	start := textWidth(row) - textWidth(helpStr)
+	if expected := (120 - textWidth(helpStr)) / 2; start != expected {
+		t.Fatalf("Expected the help to start at %d, got %d: %q", expected, start, row)
+	}
+}
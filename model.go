@@ -0,0 +1,117 @@
+package main
+
+import "slices"
+
+// model is the list of keys, the prompt that filters it and the part of it
+// that is in view. Its methods only change the model, loading the selected
+// secret and drawing is left to the Ui. visible is the number of keys that
+// fit in the list.
+type model struct {
+	Keys         []string
+	FilteredKeys []string
+	Prompt       lineEditor
+	ViewStart    int
+	ViewEnd      int
+	// Cursor is the index of the selected key in the view
+	Cursor int
+}
+
+type Match struct {
+	Key                string
+	ConsecutiveMatches int
+}
+
+// filter keeps the keys that match the prompt, the best matches first, and
+// shows them from the start
+func (m *model) filter(visible int) {
+	matches := []Match{}
+	for _, k := range m.Keys {
+		if match, consecutive := matchesPrompt(m.Prompt.String(), k); match {
+			matches = append(matches, Match{Key: k, ConsecutiveMatches: consecutive})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return b.ConsecutiveMatches - a.ConsecutiveMatches
+	})
+	m.FilteredKeys = []string{}
+	for _, match := range matches {
+		m.FilteredKeys = append(m.FilteredKeys, match.Key)
+	}
+	m.ViewStart = 0
+	m.ViewEnd = min(visible, len(m.FilteredKeys))
+	if len(m.FilteredKeys) == 0 {
+		m.Cursor = 0
+	} else {
+		m.Cursor = min(m.Cursor, len(m.FilteredKeys)-1)
+	}
+}
+
+// selected is the key under the cursor, false if no key matches the prompt
+func (m model) selected() (string, bool) {
+	if len(m.FilteredKeys) == 0 {
+		return "", false
+	}
+	return m.FilteredKeys[m.ViewStart+m.Cursor], true
+}
+
+// inView are the keys that are shown in the list
+func (m model) inView() []string {
+	return m.FilteredKeys[m.ViewStart:m.ViewEnd]
+}
+
+// selectNext moves the cursor to the next key, scrolling the view when the
+// cursor gets within SCROLL_OFF keys of its end
+func (m *model) selectNext(visible int) {
+	if m.ViewStart+m.Cursor+1 >= len(m.FilteredKeys) {
+		return
+	}
+	if m.Cursor+1 >= visible-SCROLL_OFF && m.ViewEnd < len(m.FilteredKeys) {
+		m.ViewStart++
+		m.ViewEnd++
+	} else {
+		m.Cursor++
+	}
+}
+
+func (m *model) selectPrevious() {
+	if m.Cursor == 0 {
+		return
+	}
+	if m.Cursor-1 < SCROLL_OFF && m.ViewStart > 0 {
+		m.ViewStart--
+		m.ViewEnd--
+	} else {
+		m.Cursor--
+	}
+}
+
+// selectInView moves the cursor to the key at index i in the view. It returns
+// false if there is no key there.
+func (m *model) selectInView(i int) bool {
+	if i < 0 || m.ViewStart+i >= m.ViewEnd {
+		return false
+	}
+	m.Cursor = i
+	return true
+}
+
+// jumpTo selects the key at index target in the filtered keys, with the view
+// centred on it
+func (m *model) jumpTo(target, visible int) {
+	m.ViewStart = min(max(target-visible/2, 0), max(len(m.FilteredKeys)-visible, 0))
+	m.ViewEnd = min(m.ViewStart+visible, len(m.FilteredKeys))
+	m.Cursor = target - m.ViewStart
+}
+
+// fit makes the view fit in the list after its size changed, keeping the same
+// key selected
+func (m *model) fit(visible int) {
+	selected := m.ViewStart + m.Cursor
+	n := max(visible, 1)
+	m.ViewStart = min(m.ViewStart, max(len(m.FilteredKeys)-n, 0))
+	if selected >= m.ViewStart+n {
+		m.ViewStart = selected - n + 1
+	}
+	m.ViewEnd = min(m.ViewStart+n, len(m.FilteredKeys))
+	m.Cursor = selected - m.ViewStart
+}
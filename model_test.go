@@ -0,0 +1,103 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestModelFilter(t *testing.T) {
+	tests := map[string]struct {
+		prompt   string
+		cursor   int
+		expected []string
+		viewEnd  int
+		after    int
+	}{
+		"empty prompt":             {prompt: "", cursor: 2, expected: []string{"/app/db", "/app/api", "/infra/db", "/team"}, viewEnd: 3, after: 2},
+		"best match first":         {prompt: "db", cursor: 0, expected: []string{"/app/db", "/infra/db"}, viewEnd: 2, after: 0},
+		"cursor after the matches": {prompt: "infra", cursor: 2, expected: []string{"/infra/db"}, viewEnd: 1, after: 0},
+		"no matches":               {prompt: "nope", cursor: 1, expected: []string{}, viewEnd: 0, after: 0},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := model{Keys: []string{"/app/db", "/app/api", "/infra/db", "/team"}, Cursor: test.cursor}
+			m.Prompt.set(test.prompt)
+			m.filter(3)
+			if !slices.Equal(m.FilteredKeys, test.expected) {
+				t.Fatalf("Expected keys %v, got %v", test.expected, m.FilteredKeys)
+			}
+			if m.ViewStart != 0 || m.ViewEnd != test.viewEnd {
+				t.Fatalf("Expected view 0-%d, got %d-%d", test.viewEnd, m.ViewStart, m.ViewEnd)
+			}
+			if m.Cursor != test.after {
+				t.Fatalf("Expected cursor at %d, got %d", test.after, m.Cursor)
+			}
+		})
+	}
+}
+
+func TestModelMove(t *testing.T) {
+	tests := map[string]struct {
+		nKeys     int
+		scrollOff int
+		// moves is the number of keys to move, negative to move back
+		moves     int
+		viewStart int
+		cursor    int
+	}{
+		"next":                        {nKeys: 10, scrollOff: 1, moves: 2, viewStart: 0, cursor: 2},
+		"scrolls near the end":        {nKeys: 10, scrollOff: 1, moves: 5, viewStart: 2, cursor: 3},
+		"stops at the last key":       {nKeys: 10, scrollOff: 1, moves: 20, viewStart: 5, cursor: 4},
+		"few keys":                    {nKeys: 3, scrollOff: 1, moves: 5, viewStart: 0, cursor: 2},
+		"back":                        {nKeys: 10, scrollOff: 1, moves: -1, viewStart: 0, cursor: 0},
+		"scroll off larger than view": {nKeys: 10, scrollOff: 10, moves: 3, viewStart: 3, cursor: 0},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			scrollOff := SCROLL_OFF
+			SCROLL_OFF = test.scrollOff
+			defer func() { SCROLL_OFF = scrollOff }()
+			m := model{}
+			for i := 0; i < test.nKeys; i++ {
+				m.Keys = append(m.Keys, string(rune('a'+i)))
+			}
+			m.filter(5)
+			for i := 0; i < test.moves; i++ {
+				m.selectNext(5)
+			}
+			for i := 0; i < -test.moves; i++ {
+				m.selectPrevious()
+			}
+			if m.ViewStart != test.viewStart || m.Cursor != test.cursor {
+				t.Fatalf("Expected view start %d and cursor %d, got %d and %d", test.viewStart, test.cursor, m.ViewStart, m.Cursor)
+			}
+			if m.ViewEnd != min(m.ViewStart+5, test.nKeys) {
+				t.Fatalf("Expected view end %d, got %d", min(m.ViewStart+5, test.nKeys), m.ViewEnd)
+			}
+		})
+	}
+}
+
+func TestModelFit(t *testing.T) {
+	tests := map[string]struct {
+		visible   int
+		viewStart int
+		cursor    int
+	}{
+		"grown":  {visible: 8, viewStart: 2, cursor: 4},
+		"shrunk": {visible: 2, viewStart: 5, cursor: 1},
+		"empty":  {visible: 0, viewStart: 6, cursor: 0},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := model{FilteredKeys: make([]string, 10), ViewStart: 3, ViewEnd: 8, Cursor: 3}
+			m.fit(test.visible)
+			if m.ViewStart != test.viewStart || m.Cursor != test.cursor {
+				t.Fatalf("Expected view start %d and cursor %d, got %d and %d", test.viewStart, test.cursor, m.ViewStart, m.Cursor)
+			}
+			if m.ViewStart+m.Cursor != 6 {
+				t.Fatalf("Expected key 6 to stay selected, got %d", m.ViewStart+m.Cursor)
+			}
+		})
+	}
+}
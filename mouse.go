@@ -0,0 +1,85 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// handleMouse selects what was clicked on: a key in the list, a position in
+// the scrollbar, a mount in the stats bar or a field in the secret, if it is
+// shown. The wheel moves the cursor in the list.
+func (u *Ui) handleMouse(ev *tcell.EventMouse) command {
+	buttons := ev.Buttons()
+	pressed := buttons&tcell.Button1 != 0 && u.mouseButtons&tcell.Button1 == 0
+	u.mouseButtons = buttons
+	x, y := ev.Position()
+	l := u.layout()
+	scrollbar := rect{X: l.ScrollbarX, Y: l.List.Y, Width: 1, Height: l.List.Height}
+	switch {
+	case buttons&tcell.WheelUp != 0:
+		return u.cursorUp()
+	case buttons&tcell.WheelDown != 0:
+		return u.cursorDown()
+	case !pressed:
+		return nil
+	case y == l.StatsY:
+		return u.clickMount(x)
+	case l.ListVisible && scrollbar.contains(x, y) && len(u.FilteredKeys) > l.List.Height:
+		return u.jumpTo(l, y)
+	case l.ListVisible && l.List.contains(x, y):
+		return u.clickKey(l, y)
+	case l.DetailVisible && l.Detail.contains(x, y) && u.secretShown():
+		u.clickField(y - l.Detail.Y)
+	}
+	return nil
+}
+
+func (u *Ui) clickMount(x int) command {
+	i := slices.IndexFunc(u.mountSpans(), func(span mountSpan) bool {
+		return x >= span.Start && x < span.End
+	})
+	if i < 0 || i == u.CurrentMount {
+		return nil
+	}
+	return u.showMount(i)
+}
+
+func (u *Ui) clickKey(l screenLayout, y int) command {
+	if u.selectInView(u.keyIndex(l, y)) {
+		return u.setSecret()
+	}
+	return nil
+}
+
+// jumpTo shows the part of the list that corresponds to the row in the
+// scrollbar, with the cursor in the middle
+func (u *Ui) jumpTo(l screenLayout, y int) command {
+	nKeys := l.List.Height
+	fullHeight := nKeys - 1
+	if fullHeight <= 0 {
+		return nil
+	}
+	u.model.jumpTo(u.keyIndex(l, y)*(len(u.FilteredKeys)-1)/fullHeight, nKeys)
+	return u.setSecret()
+}
+
+// secretShown is true if the detail pane has the secret, and not the report,
+// a diff or drift
+func (u *Ui) secretShown() bool {
+	return !u.ShowReport && u.Diff == nil && u.Drift == nil
+}
+
+// clickField selects the field on the row in the secret pane, counted from
+// the top of the pane. The rows are laid out like drawSecret does.
+func (u *Ui) clickField(y int) {
+	row := 1
+	for i, field := range u.fields() {
+		height := dataHeight(u.Secret.Data[field])
+		if y >= row && y < row+height {
+			u.Field = i
+			return
+		}
+		row += height
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// profileState is kept for each profile that pole has connected to, so that
+// switching back to it is instant
+type profileState struct {
+	Store        SecretStore
+	Mounts       []string
+	CurrentMount int
+}
+
+// switchProfile shows the keys in the profile, connecting to it first if it
+// hasn't been done already. The current profile is kept if something goes
+// wrong.
+func (u *Ui) switchProfile(name string) command {
+	if state, found := u.profileStates[name]; found {
+		return u.enterProfile(name, state)
+	}
+	u.Busy = fmt.Sprintf("Connecting to %s...", name)
+	profile := u.Profiles[name]
+	return func() tcell.Event {
+		return connect(name, profile)
+	}
+}
+
+// profileEvent has the store and the mounts of a profile that pole has
+// connected to. If the user must log in first, loginReason tells why.
+type profileEvent struct {
+	tcell.EventTime
+	name        string
+	store       SecretStore
+	mounts      []string
+	loginReason string
+	err         error
+}
+
+// connect creates a client for the profile and finds the mounts, unless the
+// token isn't valid
+func connect(name string, profile Profile) *profileEvent {
+	client, err := profile.client()
+	if err != nil {
+		return &profileEvent{name: name, err: fmt.Errorf("Failed to create a client for profile %s: %s", name, err)}
+	}
+	token, source, tokenErr := profile.token(context.Background(), client)
+	if tokenErr != nil {
+		slog.Info("Failed to find a vault token", "profile", name, "source", source, "err", tokenErr)
+	} else {
+		slog.Info("Found vault token", "profile", name, "source", source)
+	}
+	client.Token = token
+	store := kvClient{client: client}
+	if tokenErr != nil {
+		return &profileEvent{name: name, store: store, loginReason: tokenErr.Error()}
+	}
+	if _, err := store.LookupSelf(); err != nil {
+		return &profileEvent{name: name, store: store, loginReason: err.Error()}
+	}
+	return loadMounts(name, store)
+}
+
+// loadMounts finds the kv mounts of the profile in the store
+func loadMounts(name string, store SecretStore) *profileEvent {
+	mounts, err := store.GetMounts()
+	if err != nil {
+		return &profileEvent{name: name, err: fmt.Errorf("Failed to get mounts for profile %s: %s", name, err)}
+	}
+	if len(mounts) == 0 {
+		return &profileEvent{name: name, err: fmt.Errorf("Found no kv mounts in profile %s", name)}
+	}
+	return &profileEvent{name: name, store: store, mounts: mounts}
+}
+
+// apply switches to the profile, after the user has logged in if that is
+// needed
+func (ev *profileEvent) apply(u *Ui) command {
+	u.Busy = ""
+	if store, ok := ev.store.(TokenStore); ok && ev.loginReason != "" {
+		u.login(ev.name, store, ev.loginReason, func(u *Ui, store TokenStore) command {
+			u.Busy = fmt.Sprintf("Connecting to %s...", ev.name)
+			return func() tcell.Event {
+				return loadMounts(ev.name, store)
+			}
+		}, func(u *Ui) command {
+			u.profileFailed(fmt.Errorf("Not logged in to profile %s", ev.name))
+			return nil
+		})
+		return nil
+	}
+	if ev.err != nil {
+		u.profileFailed(ev.err)
+		return nil
+	}
+	state := &profileState{Store: ev.store, Mounts: ev.mounts}
+	defaultMount := u.Profiles[ev.name].DefaultMount
+	if defaultMount == "" {
+		defaultMount = u.DefaultMount
+	}
+	if defaultMount != "" {
+		if i := slices.Index(ev.mounts, strings.Trim(defaultMount, "/")); i >= 0 {
+			state.CurrentMount = i
+		} else {
+			u.Error = fmt.Sprintf("The default mount %s is not a kv mount in profile %s", defaultMount, ev.name)
+		}
+	}
+	u.profileStates[ev.name] = state
+	return u.enterProfile(ev.name, state)
+}
+
+// profileFailed shows why pole couldn't switch profile and stays in the
+// current one. When pole starts there is no current profile, then it exits
+// with the error.
+func (u *Ui) profileFailed(err error) {
+	if u.Profile == "" {
+		u.Quit = true
+		u.QuitErr = err
+		return
+	}
+	u.Error = err.Error()
+}
+
+// enterProfile switches to the profile and loads the keys in it
+func (u *Ui) enterProfile(name string, state *profileState) command {
+	// When pole starts the prompt has the initial query
+	if u.Profile != "" {
+		u.resetPrompt()
+	}
+	u.saveProfile()
+	u.restoreProfile(name, state)
+	u.Keys, u.Report = nil, nil
+	return batch(u.newKeysView(), u.watchToken(), u.loadKeys())
+}
+
+func (u *Ui) saveProfile() {
+	state, found := u.profileStates[u.Profile]
+	if !found {
+		return
+	}
+	state.Store = u.Store
+	state.Mounts = u.Mounts
+	state.CurrentMount = u.CurrentMount
+}
+
+func (u *Ui) restoreProfile(name string, state *profileState) {
+	u.Profile = name
+	u.Store = state.Store
+	u.Mounts = state.Mounts
+	u.CurrentMount = state.CurrentMount
+}
+
+// profileDialog lets the user choose a profile to switch to from a list
+type profileDialog struct {
+	names    []string
+	selected int
+}
+
+func (u *Ui) pickProfile() {
+	d := &profileDialog{names: profileNames(u.Profiles)}
+	for i, name := range d.names {
+		if name == u.Profile {
+			d.selected = i
+		}
+	}
+	u.Dialog = d
+}
+
+func (d *profileDialog) handleKey(u *Ui, ev *tcell.EventKey) command {
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		u.Dialog = nil
+	case tcell.KeyEnter:
+		u.Dialog = nil
+		if name := d.names[d.selected]; name != u.Profile {
+			return u.switchProfile(name)
+		}
+	case tcell.KeyCtrlK, tcell.KeyCtrlP, tcell.KeyUp:
+		d.selected = (d.selected - 1 + len(d.names)) % len(d.names)
+	case tcell.KeyCtrlJ, tcell.KeyCtrlN, tcell.KeyDown:
+		d.selected = (d.selected + 1) % len(d.names)
+	}
+	return nil
+}
+
+func (d *profileDialog) draw(u Ui) {
+	names, selected := d.names, d.selected
+	u.Screen.HideCursor()
+	x := 2
+	y := 1
+	drawLine(u.Screen, x, y, tcell.StyleDefault.Bold(true), "Switch profile")
+	y += 2
+	for i, name := range names {
+		if i == selected {
+			drawLine(u.Screen, x, y, STYLE_CURSOR, " ")
+		}
+		end := drawLine(u.Screen, x+2, y, profileStyle(u.Profiles[name]), fmt.Sprintf(" %s ", name))
+		end = drawLine(u.Screen, end+1, y, STYLE_NULL, u.Profiles[name].Address)
+		if name == u.Profile {
+			drawLine(u.Screen, end+1, y, STYLE_STRING, "(current)")
+		}
+		y++
+	}
+	helpStr := "Move ↑↓ Switch <Enter> Cancel <Esc>"
+	drawLine(u.Screen, x, u.Height-1, STYLE_HELP, helpStr)
+}
+
+// profileStyle makes the profile name stand out, in the color of the
+// profile if it has one
+func profileStyle(profile Profile) tcell.Style {
+	if profile.Color == "" {
+		return tcell.StyleDefault.Reverse(true).Bold(true)
+	}
+	return tcell.StyleDefault.Background(tcell.GetColor(profile.Color)).Foreground(tcell.ColorBlack).Bold(true)
+}
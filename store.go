@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/slarwise/pole/vault"
+)
+
+// Secret is one version of a secret in a store
+type Secret struct {
+	Data map[string]interface{}
+	// Metadata is what the store knows about the version, like when it
+	// was created
+	Metadata map[string]interface{}
+	// Url shows the secret in the web ui of the store and Cli is a command
+	// that reads it, they are empty if the store has none
+	Url string
+	Cli string
+}
+
+// MarshalJSON writes the secret in the layout of the vault api, which is
+// what select has always printed
+func (s Secret) MarshalJSON() ([]byte, error) {
+	type data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	return json.Marshal(struct {
+		Url  string `json:"url"`
+		Cli  string `json:"cli"`
+		Data data   `json:"data"`
+	}{s.Url, s.Cli, data{s.Data, s.Metadata}})
+}
+
+// Unreadable is a directory that could not be listed when finding keys, the
+// keys below it are missing
+type Unreadable struct {
+	Path   string
+	Reason string
+	Err    string
+}
+
+// Report lists the directories that could not be listed when finding keys
+type Report []Unreadable
+
+// Version describes one version of a secret in a VersionedStore
+type Version struct {
+	Version     int
+	CreatedTime time.Time
+	// DeletionTime is the zero time for versions that are not deleted
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// CopyOptions changes how a SecretCopier copies secrets
+type CopyOptions struct {
+	// Metadata copies the custom metadata as well
+	Metadata bool
+	// Overwrite writes over secrets that exist at the destination
+	Overwrite bool
+	// Move deletes the source with all of its versions after it has been
+	// written
+	Move bool
+}
+
+// CopyResult tells how copying one secret went
+type CopyResult struct {
+	From string
+	To   string
+	// Err is nil if the secret was copied
+	Err error
+}
+
+// Capabilities are what the user may do with a secret
+type Capabilities struct {
+	Read   bool
+	List   bool
+	Create bool
+	Update bool
+	Delete bool
+	Patch  bool
+	// DeleteAllVersions removes the secret with its history
+	DeleteAllVersions bool
+}
+
+// Operation is something the user may or may not be allowed to do
+type Operation struct {
+	Name    string
+	Allowed bool
+}
+
+// Operations lists the operations together with whether they are allowed, in
+// a stable order
+func (c Capabilities) Operations() []Operation {
+	return []Operation{
+		{"read", c.Read},
+		{"list", c.List},
+		{"create", c.Create},
+		{"update", c.Update},
+		{"delete", c.Delete},
+		{"patch", c.Patch},
+	}
+}
+
+// TokenInfo describes the token of a TokenStore
+type TokenInfo struct {
+	DisplayName string
+	Policies    []string
+	// TTL is in seconds
+	TTL       int
+	Renewable bool
+}
+
+// TokenStatus is how long the token of a TokenStore is valid
+type TokenStatus struct {
+	Info TokenInfo
+	// Expires is the zero time for tokens that never expire
+	Expires time.Time
+	Warning string
+}
+
+// Remaining returns how long is left until the token expires
+func (s TokenStatus) Remaining() time.Duration {
+	if s.Expires.IsZero() {
+		return 0
+	}
+	return max(time.Until(s.Expires), 0)
+}
+
+// SecretStore is a backend with secrets that pole can browse. The secrets
+// are in mounts, each with a flat list of keys like /app/db.
+type SecretStore interface {
+	// Address identifies the store, e.g. the url of the server
+	Address() string
+	GetMounts() ([]string, error)
+	GetKeys(mount string) ([]string, Report, error)
+	GetSecret(mount, name string) (Secret, error)
+}
+
+// The interfaces below are optional, the ui checks if the store implements
+// them and leaves out what it can't do
+
+// SecretWriter is a store that can write secrets
+type SecretWriter interface {
+	SecretStore
+	PutSecret(mount, name string, data map[string]interface{}) error
+}
+
+// VersionedStore is a store that keeps the earlier versions of secrets
+type VersionedStore interface {
+	SecretStore
+	// GetVersions lists the versions of the secret, oldest first
+	GetVersions(mount, name string) ([]Version, error)
+	GetSecretVersion(mount, name string, version int) (Secret, error)
+}
+
+// SecretCopier is a store that can copy and move secrets, also between
+// mounts
+type SecretCopier interface {
+	SecretStore
+	Copy(fromMount, fromName, toMount, toName string, options CopyOptions) error
+	// CopyTree copies the secrets below fromPrefix to below toPrefix
+	CopyTree(fromMount, fromPrefix, toMount, toPrefix string, options CopyOptions) ([]CopyResult, error)
+}
+
+// CapabilityChecker is a store that can tell what the user is allowed to do
+// with the secrets
+type CapabilityChecker interface {
+	SecretStore
+	GetCapabilities(mount string, keys []string) (map[string]Capabilities, error)
+}
+
+// TokenStore is a store that is accessed with a token, which can expire and
+// be replaced by logging in
+type TokenStore interface {
+	SecretStore
+	// WithToken is a copy of the store that uses the token, sharing the
+	// cache, which is kept apart for each token
+	WithToken(token string) TokenStore
+	ClearCache()
+	LookupSelf() (TokenInfo, error)
+	WatchToken(info TokenInfo, notify func(TokenStatus)) (stop func())
+	LoginUserpass(mount, username, password string) (string, error)
+	LoginLDAP(mount, username, password string) (string, error)
+}
+
+// kvClient is the store for the kv v2 mounts in a vault server. The ui sends
+// the requests from commands, which run until they are done, so they are
+// sent without a deadline.
+type kvClient struct {
+	client vault.Client
+}
+
+func (c kvClient) Address() string {
+	return c.client.Addr
+}
+
+func (c kvClient) GetMounts() ([]string, error) {
+	return c.client.GetMounts(context.Background())
+}
+
+func (c kvClient) GetKeys(mount string) ([]string, Report, error) {
+	keys, report, err := c.client.GetKeys(context.Background(), mount)
+	return keys, newReport(report), err
+}
+
+func (c kvClient) GetSecret(mount, name string) (Secret, error) {
+	secret, err := c.client.GetSecret(context.Background(), mount, name)
+	return newSecret(secret), err
+}
+
+func (c kvClient) PutSecret(mount, name string, data map[string]interface{}) error {
+	return c.client.PutSecret(context.Background(), mount, name, data)
+}
+
+func (c kvClient) GetVersions(mount, name string) ([]Version, error) {
+	versions, err := c.client.GetVersions(context.Background(), mount, name)
+	if err != nil {
+		return nil, err
+	}
+	result := []Version{}
+	for _, v := range versions {
+		result = append(result, Version(v))
+	}
+	return result, nil
+}
+
+func (c kvClient) GetSecretVersion(mount, name string, version int) (Secret, error) {
+	secret, err := c.client.GetSecretVersion(context.Background(), mount, name, version)
+	return newSecret(secret), err
+}
+
+func (c kvClient) Copy(fromMount, fromName, toMount, toName string, options CopyOptions) error {
+	return c.client.Copy(context.Background(), fromMount, fromName, toMount, toName, vault.CopyOptions(options))
+}
+
+func (c kvClient) CopyTree(fromMount, fromPrefix, toMount, toPrefix string, options CopyOptions) ([]CopyResult, error) {
+	results, err := c.client.CopyTree(context.Background(), fromMount, fromPrefix, toMount, toPrefix, vault.CopyOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	r := []CopyResult{}
+	for _, result := range results {
+		r = append(r, CopyResult(result))
+	}
+	return r, nil
+}
+
+func (c kvClient) GetCapabilities(mount string, keys []string) (map[string]Capabilities, error) {
+	capabilities, err := c.client.GetCapabilities(context.Background(), mount, keys)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]Capabilities, len(capabilities))
+	for key, c := range capabilities {
+		result[key] = Capabilities(c)
+	}
+	return result, nil
+}
+
+func (c kvClient) WithToken(token string) TokenStore {
+	c.client.Token = token
+	return c
+}
+
+func (c kvClient) ClearCache() {
+	c.client.ClearCache()
+}
+
+func (c kvClient) LookupSelf() (TokenInfo, error) {
+	info, err := c.client.LookupSelf(context.Background())
+	return TokenInfo(info), err
+}
+
+func (c kvClient) WatchToken(info TokenInfo, notify func(TokenStatus)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.client.WatchToken(ctx, vault.TokenInfo(info), func(status vault.TokenStatus) {
+		notify(TokenStatus{Info: TokenInfo(status.Info), Expires: status.Expires, Warning: status.Warning})
+	})
+	return cancel
+}
+
+func (c kvClient) LoginUserpass(mount, username, password string) (string, error) {
+	return c.client.LoginUserpass(context.Background(), mount, username, password)
+}
+
+func (c kvClient) LoginLDAP(mount, username, password string) (string, error) {
+	return c.client.LoginLDAP(context.Background(), mount, username, password)
+}
+
+// kvClient implements all of the optional interfaces
+var (
+	_ SecretWriter      = kvClient{}
+	_ VersionedStore    = kvClient{}
+	_ SecretCopier      = kvClient{}
+	_ CapabilityChecker = kvClient{}
+	_ TokenStore        = kvClient{}
+)
+
+func newSecret(secret vault.Secret) Secret {
+	return Secret{
+		Data:     secret.Data.Data,
+		Metadata: secret.Data.Metadata,
+		Url:      secret.Url,
+		Cli:      secret.Cli,
+	}
+}
+
+func newReport(report vault.Report) Report {
+	if report == nil {
+		return nil
+	}
+	r := Report{}
+	for _, u := range report {
+		r = append(r, Unreadable{Path: u.Path, Reason: string(u.Reason), Err: u.Err})
+	}
+	return r
+}
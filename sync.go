@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/slarwise/pole/vault"
+)
+
+// What to do with secrets that exist in both mounts with different data
+const (
+	CONFLICT_SKIP       = "skip"
+	CONFLICT_OVERWRITE  = "overwrite"
+	CONFLICT_NEWER_WINS = "newer-wins"
+)
+
+var CONFLICT_POLICIES = []string{CONFLICT_SKIP, CONFLICT_OVERWRITE, CONFLICT_NEWER_WINS}
+
+// What syncing does with a secret
+const (
+	SYNC_CREATE    = "create"
+	SYNC_UPDATE    = "update"
+	SYNC_SKIP      = "skip"
+	SYNC_UNCHANGED = "unchanged"
+	SYNC_FAILED    = "failed"
+)
+
+// syncEndpoint is a mount in the vault server of a profile
+type syncEndpoint struct {
+	Profile string
+	Mount   string
+	Client  vault.Client
+}
+
+func (e syncEndpoint) String() string {
+	return e.Profile + ":" + e.Mount
+}
+
+// parseEndpoint parses profile:mount
+func parseEndpoint(s string) (profile string, mount string, err error) {
+	profile, mount, found := strings.Cut(s, ":")
+	if !found || profile == "" || mount == "" {
+		return "", "", fmt.Errorf("Failed to parse %s, expected <profile>:<mount>", s)
+	}
+	return profile, strings.Trim(mount, "/"), nil
+}
+
+type syncOptions struct {
+	// Conflict is one of CONFLICT_POLICIES
+	Conflict string
+	// PreserveMetadata copies the custom metadata of the secrets
+	PreserveMetadata bool
+	// Concurrency is the max number of secrets that are read or written at
+	// once
+	Concurrency int
+}
+
+// syncStep is what syncing does with one secret. The data is kept for
+// writing it and is never printed.
+type syncStep struct {
+	Key    string
+	Action string
+	Reason string
+	data   map[string]interface{}
+	// custom is the custom metadata to write, nil if it isn't preserved
+	custom map[string]string
+	// metadataOnly is true if the data is the same and only the custom
+	// metadata needs to be written
+	metadataOnly bool
+	// version is the version of the secret in the destination when the
+	// plan was made, 0 if it doesn't exist. Syncs and imports write with it
+	// as the check-and-set version, so that changes made since the plan are
+	// kept.
+	version int
+}
+
+// planSync compares the secrets in the mounts and decides what to do with
+// each secret in from
+func planSync(ctx context.Context, from, to syncEndpoint, options syncOptions) ([]syncStep, error) {
+	fromKeys, report, err := from.Client.GetKeys(ctx, from.Mount)
+	if err != nil {
+		return nil, err
+	}
+	if len(report) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s", from, report)
+	}
+	toKeys, report, err := to.Client.GetKeys(ctx, to.Mount)
+	if err != nil {
+		return nil, err
+	}
+	if len(report) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s", to, report)
+	}
+	slices.Sort(fromKeys)
+	inDestination := make(map[string]bool, len(toKeys))
+	for _, key := range toKeys {
+		inDestination[key] = true
+	}
+	steps := make([]syncStep, len(fromKeys))
+	limit := make(chan struct{}, max(options.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, key := range fromKeys {
+		steps[i].Key = key
+		wg.Add(1)
+		go func(step *syncStep) {
+			defer wg.Done()
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-limit }()
+			*step = planStep(ctx, from, to, step.Key, inDestination[step.Key], options)
+		}(&steps[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to plan sync from %s to %s: %w", from, to, err)
+	}
+	return steps, nil
+}
+
+func planStep(ctx context.Context, from, to syncEndpoint, key string, exists bool, options syncOptions) syncStep {
+	step := syncStep{Key: key}
+	failed := func(err error) syncStep {
+		step.Action = SYNC_FAILED
+		step.Reason = err.Error()
+		return step
+	}
+	source, err := from.Client.GetSecret(ctx, from.Mount, key)
+	if err != nil {
+		return failed(err)
+	}
+	if source.Data.Data == nil {
+		step.Action = SYNC_SKIP
+		step.Reason = "deleted in source"
+		return step
+	}
+	step.data = source.Data.Data
+	var sourceMetadata vault.Metadata
+	if options.PreserveMetadata || options.Conflict == CONFLICT_NEWER_WINS {
+		sourceMetadata, err = from.Client.GetMetadata(ctx, from.Mount, key)
+		if err != nil {
+			return failed(err)
+		}
+	}
+	if options.PreserveMetadata {
+		step.custom = sourceMetadata.CustomMetadata
+		if step.custom == nil {
+			step.custom = map[string]string{}
+		}
+	}
+	if !exists {
+		step.Action = SYNC_CREATE
+		return step
+	}
+	destination, err := to.Client.GetSecret(ctx, to.Mount, key)
+	if err != nil {
+		return failed(err)
+	}
+	version, _ := destination.Data.Metadata["version"].(float64)
+	step.version = int(version)
+	var destinationMetadata vault.Metadata
+	if options.PreserveMetadata || options.Conflict == CONFLICT_NEWER_WINS {
+		destinationMetadata, err = to.Client.GetMetadata(ctx, to.Mount, key)
+		if err != nil {
+			return failed(err)
+		}
+	}
+	if reflect.DeepEqual(source.Data.Data, destination.Data.Data) {
+		if options.PreserveMetadata && !maps.Equal(step.custom, destinationMetadata.CustomMetadata) {
+			step.Action = SYNC_UPDATE
+			step.Reason = "custom metadata differs"
+			step.metadataOnly = true
+			return step
+		}
+		step.Action = SYNC_UNCHANGED
+		return step
+	}
+	switch options.Conflict {
+	case CONFLICT_OVERWRITE:
+		step.Action = SYNC_UPDATE
+		step.Reason = "overwrite"
+	case CONFLICT_NEWER_WINS:
+		if sourceMetadata.UpdatedTime.After(destinationMetadata.UpdatedTime) {
+			step.Action = SYNC_UPDATE
+			step.Reason = "source is newer"
+		} else {
+			step.Action = SYNC_SKIP
+			step.Reason = "destination is newer"
+		}
+	default:
+		step.Action = SYNC_SKIP
+		step.Reason = "differs in destination"
+	}
+	return step
+}
+
+// applySync writes the secrets that are created or updated in the plan, with
+// check-and-set so that secrets that have changed in the destination since
+// the plan are not overwritten. The steps that could not be written are
+// marked as failed.
+func applySync(ctx context.Context, to syncEndpoint, steps []syncStep, concurrency int) {
+	limit := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range steps {
+		step := &steps[i]
+		if step.Action != SYNC_CREATE && step.Action != SYNC_UPDATE {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				step.Action = SYNC_FAILED
+				step.Reason = ctx.Err().Error()
+				return
+			}
+			defer func() { <-limit }()
+			if !step.metadataOnly {
+				err := to.Client.PutSecretCAS(ctx, to.Mount, step.Key, step.data, step.version)
+				if errors.Is(err, vault.ErrCheckAndSet) {
+					step.Action = SYNC_FAILED
+					step.Reason = "changed in the destination since the plan was made"
+					return
+				} else if err != nil {
+					step.Action = SYNC_FAILED
+					step.Reason = err.Error()
+					return
+				}
+			}
+			if step.custom != nil {
+				if err := to.Client.PutCustomMetadata(ctx, to.Mount, step.Key, step.custom); err != nil {
+					step.Action = SYNC_FAILED
+					step.Reason = err.Error()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// writePlan lists the secrets that are not unchanged and counts the actions
+func writePlan(w io.Writer, steps []syncStep) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	counts := map[string]int{}
+	for _, step := range steps {
+		counts[step.Action]++
+		if step.Action == SYNC_UNCHANGED {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", step.Action, step.Key, step.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	summary := []string{}
+	for _, action := range []string{SYNC_CREATE, SYNC_UPDATE, SYNC_SKIP, SYNC_UNCHANGED, SYNC_FAILED} {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[action], action))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(summary, ", "))
+	return err
+}
+
+func syncCommand(ctx context.Context, profiles map[string]Profile, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "`profile:mount` to copy the secrets from")
+	toFlag := flags.String("to", "", "`profile:mount` to copy the secrets to")
+	dryRun := flags.Bool("dry-run", false, "only print what would be done")
+	conflict := flags.String("conflict", CONFLICT_SKIP, "what to do with secrets that differ in the destination, one of "+strings.Join(CONFLICT_POLICIES, ", "))
+	preserveMetadata := flags.Bool("metadata", false, "copy the custom metadata of the secrets as well")
+	concurrency := flags.Int("concurrency", vault.DEFAULT_CONCURRENCY, "max number of secrets to read or write at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *fromFlag == "" || *toFlag == "" || flags.NArg() > 0 {
+		return fmt.Errorf("Usage: pole sync -from <profile>:<mount> -to <profile>:<mount> [-dry-run] [-conflict policy] [-metadata] [-concurrency n]")
+	}
+	if !slices.Contains(CONFLICT_POLICIES, *conflict) {
+		return fmt.Errorf("Unknown conflict policy %s, expected one of %s", *conflict, strings.Join(CONFLICT_POLICIES, ", "))
+	}
+	endpoints := []syncEndpoint{}
+	for _, s := range []string{*fromFlag, *toFlag} {
+		name, mount, err := parseEndpoint(s)
+		if err != nil {
+			return err
+		}
+		profile, found := profiles[name]
+		if !found {
+			return fmt.Errorf("Unknown profile %s, the profiles are %s", name, strings.Join(profileNames(profiles), ", "))
+		}
+		client, err := profile.connect(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to connect to profile %s: %s", name, err)
+		}
+		client.Concurrency = *concurrency
+		endpoints = append(endpoints, syncEndpoint{Profile: name, Mount: mount, Client: client})
+	}
+	from, to := endpoints[0], endpoints[1]
+	if from.Client.Addr == to.Client.Addr && from.Client.Namespace == to.Client.Namespace && from.Mount == to.Mount {
+		return fmt.Errorf("Failed to sync, %s and %s are the same mount", from, to)
+	}
+	options := syncOptions{Conflict: *conflict, PreserveMetadata: *preserveMetadata, Concurrency: *concurrency}
+	steps, err := planSync(ctx, from, to, options)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Plan for syncing %s to %s:\n", from, to)
+	if err := writePlan(os.Stdout, steps); err != nil {
+		return fmt.Errorf("Failed to write plan: %s", err)
+	}
+	if *dryRun {
+		return nil
+	}
+	applySync(ctx, to, steps, *concurrency)
+	failed := 0
+	for _, step := range steps {
+		if step.Action == SYNC_FAILED {
+			failed++
+			fmt.Fprintf(os.Stderr, "Failed to sync %s: %s\n", step.Key, step.Reason)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to sync %d of %d secrets", failed, len(steps))
+	}
+	fmt.Println("Done")
+	return nil
+}
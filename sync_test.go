@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/slarwise/pole/vault"
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+const SYNC_TOKEN = "sync-token"
+
+func TestSync(t *testing.T) {
+	tests := map[string]struct {
+		options syncOptions
+		// expected are the actions by key
+		expected map[string]string
+		// data is the value of field a of each secret in the destination
+		// after syncing
+		data map[string]string
+	}{
+		"skip": {
+			options:  syncOptions{Conflict: CONFLICT_SKIP},
+			expected: map[string]string{"/new": SYNC_CREATE, "/same": SYNC_UNCHANGED, "/older": SYNC_SKIP, "/newer": SYNC_SKIP, "/deleted": SYNC_SKIP},
+			data:     map[string]string{"/new": "source", "/same": "same", "/older": "destination", "/newer": "destination"},
+		},
+		"overwrite": {
+			options:  syncOptions{Conflict: CONFLICT_OVERWRITE},
+			expected: map[string]string{"/new": SYNC_CREATE, "/same": SYNC_UNCHANGED, "/older": SYNC_UPDATE, "/newer": SYNC_UPDATE, "/deleted": SYNC_SKIP},
+			data:     map[string]string{"/new": "source", "/same": "same", "/older": "source", "/newer": "source"},
+		},
+		"newer wins": {
+			options:  syncOptions{Conflict: CONFLICT_NEWER_WINS},
+			expected: map[string]string{"/new": SYNC_CREATE, "/same": SYNC_UNCHANGED, "/older": SYNC_UPDATE, "/newer": SYNC_SKIP, "/deleted": SYNC_SKIP},
+			data:     map[string]string{"/new": "source", "/same": "same", "/older": "source", "/newer": "destination"},
+		},
+		"metadata": {
+			options:  syncOptions{Conflict: CONFLICT_SKIP, PreserveMetadata: true},
+			expected: map[string]string{"/new": SYNC_CREATE, "/same": SYNC_UPDATE, "/older": SYNC_SKIP, "/newer": SYNC_SKIP, "/deleted": SYNC_SKIP},
+			data:     map[string]string{"/new": "source", "/same": "same", "/older": "destination", "/newer": "destination"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			source := vaulttest.NewServer(SYNC_TOKEN)
+			defer source.Close()
+			destination := vaulttest.NewServer(SYNC_TOKEN)
+			defer destination.Close()
+			source.Put("secret", "/new", map[string]interface{}{"a": "source"})
+			source.Put("secret", "/same", map[string]interface{}{"a": "same"})
+			source.SetCustomMetadata("secret", "/same", map[string]string{"owner": "team"})
+			destination.Put("kv", "/same", map[string]interface{}{"a": "same"})
+			// /older is older in the destination and /newer is newer
+			destination.Put("kv", "/older", map[string]interface{}{"a": "destination"})
+			source.Put("secret", "/older", map[string]interface{}{"a": "source"})
+			source.Put("secret", "/newer", map[string]interface{}{"a": "source"})
+			destination.Put("kv", "/newer", map[string]interface{}{"a": "destination"})
+			source.Delete("secret", "/deleted", source.Put("secret", "/deleted", map[string]interface{}{"a": "source"}))
+			from := syncEndpoint{Profile: "a", Mount: "secret", Client: vault.NewClient(source.URL, vault.WithToken(SYNC_TOKEN))}
+			to := syncEndpoint{Profile: "b", Mount: "kv", Client: vault.NewClient(destination.URL, vault.WithToken(SYNC_TOKEN))}
+
+			test.options.Concurrency = 2
+			steps, err := planSync(context.Background(), from, to, test.options)
+			if err != nil {
+				t.Fatalf("Failed to plan: %s", err)
+			}
+			actions := map[string]string{}
+			for _, step := range steps {
+				actions[step.Key] = step.Action
+			}
+			if !maps.Equal(actions, test.expected) {
+				t.Fatalf("Expected actions %v, got %v", test.expected, actions)
+			}
+			applySync(context.Background(), to, steps, 2)
+			for _, step := range steps {
+				if step.Action == SYNC_FAILED {
+					t.Fatalf("Expected %s to be synced, got %s", step.Key, step.Reason)
+				}
+			}
+			check := vault.NewClient(destination.URL, vault.WithToken(SYNC_TOKEN), vault.WithoutCache())
+			for key, expected := range test.data {
+				secret, err := check.GetSecret(context.Background(), "kv", key)
+				if err != nil {
+					t.Fatalf("Failed to get %s: %s", key, err)
+				}
+				if secret.Data.Data["a"] != expected {
+					t.Fatalf("Expected %s to be %s, got %v", key, expected, secret.Data.Data["a"])
+				}
+			}
+			if _, err := check.GetSecret(context.Background(), "kv", "/deleted"); err == nil {
+				t.Fatalf("Expected the deleted secret not to be synced")
+			}
+			metadata, err := check.GetMetadata(context.Background(), "kv", "/same")
+			if err != nil {
+				t.Fatalf("Failed to get metadata: %s", err)
+			}
+			if test.options.PreserveMetadata != (metadata.CustomMetadata["owner"] == "team") {
+				t.Fatalf("Expected custom metadata to be copied only when preserved, got %v", metadata.CustomMetadata)
+			}
+			if metadata.CurrentVersion != 1 {
+				t.Fatalf("Expected only the metadata of /same to be written, got version %d", metadata.CurrentVersion)
+			}
+		})
+	}
+}
+
+func TestSyncKeepsChangesMadeAfterThePlan(t *testing.T) {
+	source := vaulttest.NewServer(SYNC_TOKEN)
+	defer source.Close()
+	destination := vaulttest.NewServer(SYNC_TOKEN)
+	defer destination.Close()
+	source.Put("secret", "/new", map[string]interface{}{"a": "source"})
+	source.Put("secret", "/changed", map[string]interface{}{"a": "source"})
+	destination.Put("kv", "/changed", map[string]interface{}{"a": "destination"})
+	from := syncEndpoint{Profile: "a", Mount: "secret", Client: vault.NewClient(source.URL, vault.WithToken(SYNC_TOKEN))}
+	to := syncEndpoint{Profile: "b", Mount: "kv", Client: vault.NewClient(destination.URL, vault.WithToken(SYNC_TOKEN))}
+	steps, err := planSync(context.Background(), from, to, syncOptions{Conflict: CONFLICT_OVERWRITE, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Failed to plan: %s", err)
+	}
+	// Both are written after the plan was made, so syncing must not
+	// overwrite them
+	destination.Put("kv", "/new", map[string]interface{}{"a": "someone else"})
+	destination.Put("kv", "/changed", map[string]interface{}{"a": "someone else"})
+	applySync(context.Background(), to, steps, 2)
+	for _, step := range steps {
+		if step.Action != SYNC_FAILED {
+			t.Fatalf("Expected %s to fail check-and-set, got %s", step.Key, step.Action)
+		}
+	}
+	check := vault.NewClient(destination.URL, vault.WithToken(SYNC_TOKEN), vault.WithoutCache())
+	for _, key := range []string{"/new", "/changed"} {
+		secret, err := check.GetSecret(context.Background(), "kv", key)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %s", key, err)
+		}
+		if secret.Data.Data["a"] != "someone else" {
+			t.Fatalf("Expected %s to be kept, got %v", key, secret.Data.Data["a"])
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		endpoint string
+		profile  string
+		mount    string
+		err      bool
+	}{
+		"profile and mount": {endpoint: "prod:secret", profile: "prod", mount: "secret"},
+		"trailing slash":    {endpoint: "prod:team/kv/", profile: "prod", mount: "team/kv"},
+		"no profile":        {endpoint: "secret", err: true},
+		"no mount":          {endpoint: "prod:", err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			profile, mount, err := parseEndpoint(test.endpoint)
+			if test.err != (err != nil) {
+				t.Fatalf("Expected error %t, got %v", test.err, err)
+			}
+			if profile != test.profile || mount != test.mount {
+				t.Fatalf("Expected %s and %s, got %s and %s", test.profile, test.mount, profile, mount)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+var updateGolden = flag.Bool("update", false, "write the screens in testdata instead of comparing with them")
+
+// fakeVault serves secrets from memory. Every token is valid and allowed to
+// do anything.
+type fakeVault struct {
+	mounts []string
+	// keys are the keys in each mount
+	keys    map[string][]string
+	secrets map[string]map[string]interface{}
+}
+
+func (f fakeVault) Address() string                   { return "http://fake:8200" }
+func (f fakeVault) WithToken(token string) TokenStore { return f }
+func (f fakeVault) ClearCache()                       {}
+
+func (f fakeVault) GetMounts() ([]string, error) {
+	return f.mounts, nil
+}
+
+func (f fakeVault) GetKeys(mount string) ([]string, Report, error) {
+	return f.keys[mount], nil, nil
+}
+
+func (f fakeVault) GetSecret(mount, name string) (Secret, error) {
+	return Secret{
+		Data: f.secrets[mount+name],
+		Url:  "http://fake:8200/ui/vault/secrets/" + mount + "/show" + name,
+		Cli:  "vault kv get -mount=" + mount + " " + name,
+	}, nil
+}
+
+func (f fakeVault) GetCapabilities(mount string, keys []string) (map[string]Capabilities, error) {
+	capabilities := make(map[string]Capabilities)
+	for _, key := range keys {
+		capabilities[key] = Capabilities{Read: true, List: true, Create: true, Update: true, Delete: true, Patch: true}
+	}
+	return capabilities, nil
+}
+
+func (f fakeVault) LookupSelf() (TokenInfo, error) {
+	return TokenInfo{DisplayName: "test"}, nil
+}
+
+func (f fakeVault) WatchToken(info TokenInfo, notify func(TokenStatus)) (stop func()) {
+	return func() {}
+}
+
+func (f fakeVault) LoginUserpass(mount, username, password string) (string, error) {
+	return "token", nil
+}
+
+func (f fakeVault) LoginLDAP(mount, username, password string) (string, error) {
+	return "token", nil
+}
+
+// plainStore only has the methods that every store has
+type plainStore struct {
+	store SecretStore
+}
+
+func (p plainStore) Address() string              { return p.store.Address() }
+func (p plainStore) GetMounts() ([]string, error) { return p.store.GetMounts() }
+func (p plainStore) GetKeys(mount string) ([]string, Report, error) {
+	return p.store.GetKeys(mount)
+}
+func (p plainStore) GetSecret(mount, name string) (Secret, error) {
+	return p.store.GetSecret(mount, name)
+}
+
+var FAKE_VAULT = fakeVault{
+	mounts: []string{"kv", "secret"},
+	keys: map[string][]string{
+		"kv":     {"/app/db", "/app/api", "/infra/dns", "/infra/db/password", "/team/readme"},
+		"secret": {"/ci/token", "/ci/deploy"},
+	},
+	secrets: map[string]map[string]interface{}{
+		"kv/app/db":            {"user": "app", "password": "hunter2"},
+		"kv/app/api":           {"key": "abc123", "scopes": []interface{}{"read", "write"}},
+		"kv/infra/dns":         {"zone": "example.com"},
+		"kv/infra/db/password": {"password": "s3cret"},
+		"kv/team/readme":       {"text": "Ask in #team"},
+		"secret/ci/token":      {"token": "ci-token"},
+		"secret/ci/deploy":     {"key": "deploy-key", "enabled": true},
+	},
+}
+
+// newTestUi shows the keys in the first mount of the store on a simulated
+// screen
+func newTestUi(t *testing.T, store SecretStore, width, height int) *Ui {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	keys, err := newKeymap(nil)
+	if err != nil {
+		t.Fatalf("Failed to create keymap: %s", err)
+	}
+	mounts, err := store.GetMounts()
+	if err != nil {
+		t.Fatalf("Failed to get mounts: %s", err)
+	}
+	u := &Ui{
+		Screen:        newTestScreen(t, width, height),
+		Width:         width,
+		Height:        height,
+		Layout:        DEFAULT_CONFIG.Layout,
+		ShowHelp:      true,
+		Keymap:        keys,
+		Store:         store,
+		Mounts:        mounts,
+		Profile:       "test",
+		Profiles:      map[string]Profile{"test": {}},
+		profileStates: make(map[string]*profileState),
+	}
+	settle(u, u.loadKeys())
+	u.Redraw()
+	return u
+}
+
+// settle runs the command, and the commands that follow from it, until
+// there are no more
+func settle(u *Ui, cmd command) {
+	for cmd != nil {
+		ev := cmd()
+		if ev == nil {
+			return
+		}
+		cmd = u.update(ev)
+	}
+}
+
+// run sends the events to the ui like the main loop does, except that the
+// commands are run before the next event instead of in the background
+func run(t *testing.T, u *Ui, events []tcell.Event) {
+	for _, ev := range events {
+		settle(u, u.update(ev))
+		if u.Quit {
+			t.Fatalf("Expected pole to keep running after %T", ev)
+		}
+		u.Redraw()
+	}
+}
+
+// typeText are the key events for typing the text
+func typeText(text string) []tcell.Event {
+	events := []tcell.Event{}
+	for _, r := range text {
+		events = append(events, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	return events
+}
+
+func keyEvent(k tcell.Key) tcell.Event {
+	return tcell.NewEventKey(k, 0, tcell.ModNone)
+}
+
+// screenText is the text on the screen, without trailing spaces
+func screenText(screen tcell.SimulationScreen) string {
+	_, _, height := screen.GetContents()
+	rows := []string{}
+	for y := 0; y < height; y++ {
+		rows = append(rows, strings.TrimRight(screenRow(screen, y), " "))
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+func TestScreens(t *testing.T) {
+	tests := map[string]struct {
+		// store is FAKE_VAULT if nil
+		store  SecretStore
+		width  int
+		height int
+		// keys are key sequences, typed one after the other
+		keys []string
+		// clicks are pressed and released after the keys
+		clicks [][2]int
+	}{
+		"start":           {width: 60, height: 10},
+		"filter":          {width: 60, height: 10, keys: []string{"d b"}},
+		"move":            {width: 60, height: 10, keys: []string{"Up Up"}},
+		"edit prompt":     {width: 60, height: 10, keys: []string{"i n f r a", "Ctrl-A Ctrl-W x", "Backspace"}},
+		"next mount":      {width: 60, height: 10, keys: []string{"Alt-Left"}},
+		"key sequence":    {width: 60, height: 10, keys: []string{"Ctrl-G ;"}},
+		"pending keys":    {width: 60, height: 10, keys: []string{"Ctrl-G"}},
+		"grow list":       {width: 60, height: 10, keys: []string{"Alt-= Alt-="}},
+		"toggle pane":     {width: 40, height: 10, keys: []string{"Ctrl-L"}},
+		"command palette": {width: 60, height: 10, keys: []string{"Ctrl-Space s w i t c h m Enter", "s e c Enter"}},
+		"click key":       {width: 60, height: 10, clicks: [][2]int{{3, 5}}},
+		"click mount":     {width: 60, height: 10, clicks: [][2]int{{20, 8}}},
+		"diff":            {width: 60, height: 10, keys: []string{"Ctrl-G d", "i n f r a / d b Enter"}},
+		"diff revealed":   {width: 60, height: 10, keys: []string{"Ctrl-G d", "i n f r a / d b Enter", "Ctrl-G r"}},
+		"drift":           {width: 60, height: 10, keys: []string{"Ctrl-G m", "s e c Enter"}},
+		"plain store":     {store: plainStore{FAKE_VAULT}, width: 60, height: 10, keys: []string{"Up"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := test.store
+			if store == nil {
+				store = FAKE_VAULT
+			}
+			u := newTestUi(t, store, test.width, test.height)
+			events := []tcell.Event{}
+			for _, seq := range test.keys {
+				keys, err := parseSequence(seq)
+				if err != nil {
+					t.Fatalf("Failed to parse %s: %s", seq, err)
+				}
+				for _, k := range keys {
+					events = append(events, tcell.NewEventKey(k.Key, k.Rune, k.Mod))
+				}
+			}
+			for _, click := range test.clicks {
+				events = append(events,
+					tcell.NewEventMouse(click[0], click[1], tcell.Button1, tcell.ModNone),
+					tcell.NewEventMouse(click[0], click[1], tcell.ButtonNone, tcell.ModNone),
+				)
+			}
+			run(t, u, events)
+			screen := screenText(u.Screen.(tcell.SimulationScreen))
+			path := filepath.Join("testdata", strings.ReplaceAll(name, " ", "-")+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(screen), 0o644); err != nil {
+					t.Fatalf("Failed to write %s: %s", path, err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read %s, run the tests with -update to create it: %s", path, err)
+			}
+			if screen != string(expected) {
+				t.Fatalf("Expected screen\n%s\ngot\n%s", expected, screen)
+			}
+		})
+	}
+}
+
+func TestCommandsRunOutsideUpdate(t *testing.T) {
+	u := newTestUi(t, FAKE_VAULT, 60, 10)
+	loadSecret := u.update(keyEvent(tcell.KeyUp))
+	first, _ := u.selected()
+	loadOther := u.update(keyEvent(tcell.KeyUp))
+	second, _ := u.selected()
+	if first == second {
+		t.Fatalf("Expected another key to be selected, got %s twice", first)
+	}
+	if len(u.Secret.Data) != 0 {
+		t.Fatalf("Expected no secret before it has been loaded, got %v", u.Secret.Data)
+	}
+	// The secret that was selected last arrives first
+	settle(u, loadOther)
+	settle(u, loadSecret)
+	expected := FAKE_VAULT.secrets["kv"+second]
+	if !reflect.DeepEqual(u.Secret.Data, expected) {
+		t.Fatalf("Expected the secret of %s, got %v", second, u.Secret.Data)
+	}
+	loadKeys := u.update(tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModAlt))
+	u.Redraw()
+	if row := screenRow(u.Screen.(tcell.SimulationScreen), 8); !strings.Contains(row, "Loading...") {
+		t.Fatalf("Expected the stats bar to show that keys are loading, got %q", row)
+	}
+	settle(u, loadKeys)
+	if !reflect.DeepEqual(u.Keys, FAKE_VAULT.keys["secret"]) {
+		t.Fatalf("Expected the keys in secret, got %v", u.Keys)
+	}
+}
+
+func TestSelectPrintsSecret(t *testing.T) {
+	u := newTestUi(t, FAKE_VAULT, 60, 10)
+	settle(u, u.update(keyEvent(tcell.KeyEnter)))
+	if !u.Quit {
+		t.Fatalf("Expected select to exit")
+	}
+	expected := `{
+  "url": "http://fake:8200/ui/vault/secrets/kv/show/app/db",
+  "cli": "vault kv get -mount=kv /app/db",
+  "data": {
+    "data": {
+      "password": "hunter2",
+      "user": "app"
+    },
+    "metadata": null
+  }
+}`
+	if string(u.Result) != expected {
+		t.Fatalf("Expected the secret in the layout of the vault api\n%s\ngot\n%s", expected, u.Result)
+	}
+}
+
+func TestClickFieldOnlyInSecret(t *testing.T) {
+	tests := map[string]struct {
+		diff  *secretDiff
+		drift *driftReport
+		moves bool
+	}{
+		"secret": {moves: true},
+		"diff":   {diff: &secretDiff{}},
+		"drift":  {drift: &driftReport{}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u := newTestUi(t, FAKE_VAULT, 60, 10)
+			run(t, u, typeText("app/db"))
+			u.Diff, u.Drift = test.diff, test.drift
+			l := u.layout()
+			moved := false
+			for y := l.Detail.Y; y < l.Detail.Y+l.Detail.Height; y++ {
+				run(t, u, []tcell.Event{
+					tcell.NewEventMouse(l.Detail.X, y, tcell.Button1, tcell.ModNone),
+					tcell.NewEventMouse(l.Detail.X, y, tcell.ButtonNone, tcell.ModNone),
+				})
+				moved = moved || u.Field != 0
+			}
+			if moved != test.moves {
+				t.Fatalf("Expected clicks in the detail pane to select a field: %t, got %t", test.moves, moved)
+			}
+		})
+	}
+}
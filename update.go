@@ -0,0 +1,273 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// command does the slow part of an update, like requests to the store or
+// running other programs. It gets what it needs when it is created and must
+// not touch the Ui, since the ui keeps handling events while it runs. The
+// event it returns is sent to update, nil if there is nothing to report.
+type command func() tcell.Event
+
+// message is an event with the result of a command, it knows how to apply
+// the result to the ui
+type message interface {
+	tcell.Event
+	apply(u *Ui) command
+}
+
+// batchEvent has the events of commands that were run together
+type batchEvent struct {
+	tcell.EventTime
+	events []tcell.Event
+}
+
+func (ev *batchEvent) apply(u *Ui) command {
+	commands := []command{}
+	for _, e := range ev.events {
+		commands = append(commands, u.update(e))
+	}
+	return batch(commands...)
+}
+
+// batch runs the commands at the same time as one command, nil commands are
+// left out
+func batch(commands ...command) command {
+	commands = slices.DeleteFunc(commands, func(c command) bool { return c == nil })
+	switch len(commands) {
+	case 0:
+		return nil
+	case 1:
+		return commands[0]
+	}
+	return func() tcell.Event {
+		events := make([]tcell.Event, len(commands))
+		var wg sync.WaitGroup
+		for i, c := range commands {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				events[i] = c()
+			}()
+		}
+		wg.Wait()
+		return &batchEvent{events: slices.DeleteFunc(events, func(e tcell.Event) bool { return e == nil })}
+	}
+}
+
+// update changes the ui after an event and returns the command to run for
+// it. It never waits for the store or draws, that is left to the commands
+// and to Redraw. Pole exits when u.Quit is set.
+func (u *Ui) update(ev tcell.Event) command {
+	switch ev := ev.(type) {
+	case message:
+		return ev.apply(u)
+	case *tcell.EventResize:
+		u.Width, u.Height = ev.Size()
+		u.resetView()
+	case *tcell.EventMouse:
+		if u.Dialog == nil {
+			return u.handleMouse(ev)
+		}
+	case *tcell.EventPaste:
+		u.Pasting = ev.Start()
+		if ev.End() {
+			u.Prompt.insert(string(u.pasted))
+			u.pasted = nil
+			return u.newKeysView()
+		}
+	case *tcell.EventKey:
+		u.Error = ""
+		u.Message = ""
+		if u.Dialog != nil {
+			return u.Dialog.handleKey(u, ev)
+		}
+		return u.handleKey(ev)
+	}
+	return nil
+}
+
+// statusEvent is the outcome of a command that is only shown in the stats
+// bar
+type statusEvent struct {
+	tcell.EventTime
+	message string
+	err     error
+}
+
+func (ev *statusEvent) apply(u *Ui) command {
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+	} else {
+		u.Message = ev.message
+	}
+	return nil
+}
+
+// currentMount is the mount that the keys are shown for, empty before the
+// mounts have been loaded
+func (u Ui) currentMount() string {
+	if u.CurrentMount >= len(u.Mounts) {
+		return ""
+	}
+	return u.Mounts[u.CurrentMount]
+}
+
+// newKeysView filters the keys by the prompt and shows the selected secret
+func (u *Ui) newKeysView() command {
+	u.filter(u.nKeysToShow())
+	return u.setSecret()
+}
+
+// secretEvent has the secret that was selected and what the token can do
+// with it
+type secretEvent struct {
+	tcell.EventTime
+	profile      string
+	mount        string
+	key          string
+	secret       Secret
+	capabilities *Capabilities
+	err          error
+}
+
+// setSecret clears the secret pane and loads the selected secret
+func (u *Ui) setSecret() command {
+	u.Secret = Secret{}
+	u.Capabilities = nil
+	u.Diff = nil
+	u.Field = 0
+	key, ok := u.selected()
+	if !ok {
+		return nil
+	}
+	store := u.Store
+	ev := &secretEvent{profile: u.Profile, mount: u.currentMount(), key: key}
+	// Ask for all visible keys at once, moving around will then mostly hit
+	// the cache
+	inView := slices.Clone(u.inView())
+	return func() tcell.Event {
+		ev.secret, ev.err = store.GetSecret(ev.mount, ev.key)
+		if ev.err != nil {
+			return ev
+		}
+		checker, ok := store.(CapabilityChecker)
+		if !ok {
+			return ev
+		}
+		capabilities, err := checker.GetCapabilities(ev.mount, inView)
+		if err != nil {
+			slog.Error("Failed to get capabilities", "mount", ev.mount, "key", ev.key, "err", err)
+			return ev
+		}
+		if c, found := capabilities[ev.key]; found {
+			ev.capabilities = &c
+		}
+		return ev
+	}
+}
+
+func (ev *secretEvent) apply(u *Ui) command {
+	// Another secret may have been selected while this one was loading
+	if key, ok := u.selected(); !ok || key != ev.key || ev.mount != u.currentMount() || ev.profile != u.Profile {
+		return nil
+	}
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+		return nil
+	}
+	u.Secret = ev.secret
+	u.Capabilities = ev.capabilities
+	return nil
+}
+
+func (u *Ui) moveUp() command {
+	u.selectNext(u.nKeysToShow())
+	return u.setSecret()
+}
+
+func (u *Ui) moveDown() command {
+	u.selectPrevious()
+	return u.setSecret()
+}
+
+func (u *Ui) nextMount() command {
+	if len(u.Mounts) < 2 {
+		return nil
+	}
+	if u.CurrentMount == 0 {
+		return u.showMount(len(u.Mounts) - 1)
+	}
+	return u.showMount(u.CurrentMount - 1)
+}
+
+func (u *Ui) previousMount() command {
+	if len(u.Mounts) < 2 {
+		return nil
+	}
+	return u.showMount((u.CurrentMount + 1) % len(u.Mounts))
+}
+
+// showMount empties the list and the prompt and loads the keys in the mount
+// at index i
+func (u *Ui) showMount(i int) command {
+	u.CurrentMount = i
+	u.Keys, u.Report = nil, nil
+	u.resetPrompt()
+	return batch(u.newKeysView(), u.loadKeys())
+}
+
+// keysEvent has the keys in a mount. Finding no keys can mean that the token
+// has expired, then loginReason tells why the token isn't valid.
+type keysEvent struct {
+	tcell.EventTime
+	profile     string
+	mount       string
+	keys        []string
+	report      Report
+	err         error
+	loginReason string
+}
+
+// loadKeys gets the keys in the current mount, the keys that are shown are
+// kept until they have been loaded
+func (u *Ui) loadKeys() command {
+	u.Busy = "Loading..."
+	store := u.Store
+	ev := &keysEvent{profile: u.Profile, mount: u.currentMount()}
+	return func() tcell.Event {
+		ev.keys, ev.report, ev.err = store.GetKeys(ev.mount)
+		if tokenStore, ok := store.(TokenStore); ok && len(ev.keys) == 0 {
+			if _, err := tokenStore.LookupSelf(); err != nil {
+				ev.loginReason = err.Error()
+			}
+		}
+		return ev
+	}
+}
+
+// apply shows the keys, or lets the user log in again and loads them once
+// more if the token isn't valid
+func (ev *keysEvent) apply(u *Ui) command {
+	if ev.profile != u.Profile || ev.mount != u.currentMount() {
+		return nil
+	}
+	u.Busy = ""
+	if store, ok := u.Store.(TokenStore); ok && ev.loginReason != "" {
+		u.login(u.Profile, store, ev.loginReason, func(u *Ui, store TokenStore) command {
+			u.Store = store
+			return batch(u.watchToken(), u.loadKeys())
+		}, nil)
+		return nil
+	}
+	if ev.err != nil {
+		u.Error = ev.err.Error()
+	}
+	u.Keys, u.Report = ev.keys, ev.report
+	return u.newKeysView()
+}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenInfo describes a token, a TTL of 0 means that it never expires
+type TokenInfo struct {
+	DisplayName string   `json:"display_name"`
+	Policies    []string `json:"policies"`
+	TTL         int      `json:"ttl"`
+	Renewable   bool     `json:"renewable"`
+}
+
+// LookupSelf checks that the token is valid and returns information about
+// it
+func (c Client) LookupSelf(ctx context.Context) (TokenInfo, error) {
+	response := struct {
+		Data TokenInfo
+	}{}
+	if err := c.doJSON(ctx, "GET", "auth/token/lookup-self", nil, &response); err != nil {
+		return TokenInfo{}, fmt.Errorf("Failed to look up token: %s", err)
+	}
+	return response.Data, nil
+}
+
+// RenewSelf renews the token and returns its new ttl in seconds
+func (c Client) RenewSelf(ctx context.Context) (int, error) {
+	response := struct {
+		Auth struct {
+			LeaseDuration int  `json:"lease_duration"`
+			Renewable     bool `json:"renewable"`
+		}
+	}{}
+	if err := c.doJSON(ctx, "POST", "auth/token/renew-self", map[string]string{}, &response); err != nil {
+		return 0, fmt.Errorf("Failed to renew token: %s", err)
+	}
+	return response.Auth.LeaseDuration, nil
+}
+
+// LoginUserpass logs in with the userpass auth method mounted at mount and
+// returns the new client token
+func (c Client) LoginUserpass(ctx context.Context, mount, username, password string) (string, error) {
+	return c.login(ctx, fmt.Sprintf("auth/%s/login/%s", mount, url.PathEscape(username)), map[string]string{"password": password})
+}
+
+// LoginLDAP logs in with the ldap auth method mounted at mount and returns the
+// new client token
+func (c Client) LoginLDAP(ctx context.Context, mount, username, password string) (string, error) {
+	return c.login(ctx, fmt.Sprintf("auth/%s/login/%s", mount, url.PathEscape(username)), map[string]string{"password": password})
+}
+
+// LoginAppRole logs in with the approle auth method mounted at mount and
+// returns the new client token
+func (c Client) LoginAppRole(ctx context.Context, mount, roleID, secretID string) (string, error) {
+	return c.login(ctx, fmt.Sprintf("auth/%s/login", mount), map[string]string{"role_id": roleID, "secret_id": secretID})
+}
+
+// LoginJWT logs in with the jwt auth method mounted at mount and returns the
+// new client token. An empty role means the default role of the auth method.
+func (c Client) LoginJWT(ctx context.Context, mount, role, jwt string) (string, error) {
+	body := map[string]string{"jwt": jwt}
+	if role != "" {
+		body["role"] = role
+	}
+	return c.login(ctx, fmt.Sprintf("auth/%s/login", mount), body)
+}
+
+func (c Client) login(ctx context.Context, path string, body any) (string, error) {
+	response := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		}
+	}{}
+	if err := c.doJSON(ctx, "POST", path, body, &response); err != nil {
+		return "", fmt.Errorf("Failed to log in: %s", err)
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("Failed to log in: no token in the response from %s", path)
+	}
+	return response.Auth.ClientToken, nil
+}
+
+// doJSON sends body as json to the vault api at path and decodes the
+// response into out. Vault error messages are included in the returned
+// error.
+func (c Client) doJSON(ctx context.Context, method, path string, body any, out any) error {
+	var requestBody []byte
+	if body != nil {
+		var err error
+		requestBody, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("Failed to marshal request body: %s", err)
+		}
+	}
+	response, responseBody, err := c.do(ctx, method, path, requestBody)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return responseError(response, responseBody)
+	}
+	if out == nil || len(responseBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		// The body can have tokens, so it is left out
+		return fmt.Errorf("Failed to parse response body of %s %s: %s", method, path, err)
+	}
+	return nil
+}
+
+// ResponseError is returned when vault responds with an error status
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Url        string
+	Errors     []string
+}
+
+func (e *ResponseError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("Got %s on url %s: %s", e.Status, e.Url, strings.Join(e.Errors, ", "))
+	}
+	return fmt.Sprintf("Got %s on url %s", e.Status, e.Url)
+}
+
+func responseError(response *http.Response, body []byte) error {
+	errorResponse := struct {
+		Errors []string
+	}{}
+	json.Unmarshal(body, &errorResponse)
+	return &ResponseError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Url:        response.Request.URL.String(),
+		Errors:     errorResponse.Errors,
+	}
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// CAPABILITIES_BATCH_SIZE is the max number of paths to ask about in one
+// request to sys/capabilities-self
+const CAPABILITIES_BATCH_SIZE = 100
+
+// Capabilities are the operations that the token can perform on a kv v2
+// secret
+type Capabilities struct {
+	Read   bool `json:"read"`
+	List   bool `json:"list"`
+	Create bool `json:"create"`
+	Update bool `json:"update"`
+	Delete bool `json:"delete"`
+	Patch  bool `json:"patch"`
+	// DeleteAllVersions is delete on the metadata path, which removes the
+	// secret with its history
+	DeleteAllVersions bool `json:"delete_all_versions"`
+}
+
+type Operation struct {
+	Name    string
+	Allowed bool
+}
+
+// Operations lists the operations together with whether they are allowed, in
+// a stable order
+func (c Capabilities) Operations() []Operation {
+	return []Operation{
+		{"read", c.Read},
+		{"list", c.List},
+		{"create", c.Create},
+		{"update", c.Update},
+		{"delete", c.Delete},
+		{"patch", c.Patch},
+	}
+}
+
+// GetCapabilities returns what the token can do with the given keys in the
+// mount, by asking for the capabilities on their data and metadata paths.
+// Capabilities are cached and the uncached paths are asked for in batches.
+func (c Client) GetCapabilities(ctx context.Context, mount string, keys []string) (map[string]Capabilities, error) {
+	all := []string{}
+	for _, key := range keys {
+		all = append(all, dataPath(mount, key), metadataPath(mount, key))
+	}
+	known := c.cache().knownCapabilities(all)
+	paths := []string{}
+	for _, path := range all {
+		if _, found := known[path]; !found && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for start := 0; start < len(paths); start += CAPABILITIES_BATCH_SIZE {
+		batch := paths[start:min(start+CAPABILITIES_BATCH_SIZE, len(paths))]
+		response := struct {
+			Data map[string][]string
+		}{}
+		if err := c.doJSON(ctx, "POST", "sys/capabilities-self", map[string][]string{"paths": batch}, &response); err != nil {
+			return nil, fmt.Errorf("Failed to get capabilities: %s", err)
+		}
+		fetched := make(map[string][]string, len(batch))
+		for _, path := range batch {
+			known[path] = response.Data[path]
+			fetched[path] = response.Data[path]
+		}
+		c.cache().setCapabilities(fetched)
+	}
+	result := make(map[string]Capabilities, len(keys))
+	for _, key := range keys {
+		data := known[dataPath(mount, key)]
+		metadata := known[metadataPath(mount, key)]
+		result[key] = Capabilities{
+			Read:              allows(data, "read"),
+			List:              allows(metadata, "list"),
+			Create:            allows(data, "create"),
+			Update:            allows(data, "update"),
+			Delete:            allows(data, "delete"),
+			Patch:             allows(data, "patch"),
+			DeleteAllVersions: allows(metadata, "delete"),
+		}
+	}
+	return result, nil
+}
+
+func allows(capabilities []string, operation string) bool {
+	if slices.Contains(capabilities, "deny") {
+		return false
+	}
+	return slices.Contains(capabilities, "root") || slices.Contains(capabilities, operation)
+}
+
+func dataPath(mount, key string) string {
+	return fmt.Sprintf("%s/data%s", mount, key)
+}
+
+func metadataPath(mount, key string) string {
+	return fmt.Sprintf("%s/metadata%s", mount, key)
+}
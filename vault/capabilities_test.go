@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body := struct {
+			Paths []string
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request: %s", err)
+		}
+		if len(body.Paths) > CAPABILITIES_BATCH_SIZE {
+			t.Fatalf("Expected at most %d paths per request, got %d", CAPABILITIES_BATCH_SIZE, len(body.Paths))
+		}
+		data := map[string][]string{}
+		for _, path := range body.Paths {
+			switch {
+			case strings.HasSuffix(path, "/root"):
+				data[path] = []string{"root"}
+			case strings.HasSuffix(path, "/denied"):
+				data[path] = []string{"deny"}
+			case strings.HasPrefix(path, "caps/metadata"):
+				data[path] = []string{"list"}
+			default:
+				data[path] = []string{"read", "update"}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	keys := []string{"/root", "/denied"}
+	for i := range CAPABILITIES_BATCH_SIZE {
+		keys = append(keys, fmt.Sprintf("/key-%d", i))
+	}
+	capabilities, err := client.GetCapabilities(context.Background(), "caps", keys)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if requests != 3 {
+		t.Fatalf("Expected %d paths to be asked for in 3 requests, got %d", 2*len(keys), requests)
+	}
+	expected := map[string]Capabilities{
+		"/root":   {Read: true, List: true, Create: true, Update: true, Delete: true, Patch: true, DeleteAllVersions: true},
+		"/denied": {},
+		"/key-0":  {Read: true, List: true, Update: true},
+	}
+	for key, e := range expected {
+		if capabilities[key] != e {
+			t.Fatalf("Expected capabilities %+v for %s, got %+v", e, key, capabilities[key])
+		}
+	}
+	if _, err := client.GetCapabilities(context.Background(), "caps", []string{"/root"}); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if requests != 3 {
+		t.Fatalf("Expected capabilities to be cached")
+	}
+}
@@ -0,0 +1,418 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_CONCURRENCY is the max number of directories that GetKeys lists at
+// once if the client doesn't say otherwise
+const DEFAULT_CONCURRENCY = 16
+
+// Client talks to the vault api. Copies of a client share its cache, which
+// keeps what was fetched with each token apart, so a copy with another token
+// only gets what that token may read. A client is safe for concurrent use.
+type Client struct {
+	Addr      string
+	Token     string
+	Namespace string
+	// HTTPClient sends the requests, a client with a timeout of
+	// REQUEST_TIMEOUT is used if it is nil
+	HTTPClient *http.Client
+	// Concurrency is the max number of directories that GetKeys lists at
+	// once, DEFAULT_CONCURRENCY if it is 0
+	Concurrency int
+	// caches are shared by copies of the client. Nothing is cached if it
+	// is nil.
+	caches *caches
+}
+
+// Option configures a client created by NewClient
+type Option func(*Client)
+
+// WithToken authenticates the requests with the token
+func WithToken(token string) Option {
+	return func(c *Client) { c.Token = token }
+}
+
+// WithNamespace sends the requests to a vault enterprise namespace
+func WithNamespace(namespace string) Option {
+	return func(c *Client) { c.Namespace = namespace }
+}
+
+// WithHTTPClient sends the requests with the http client, e.g. one from
+// TLSConfig.HTTPClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.HTTPClient = httpClient }
+}
+
+// WithConcurrency limits how many directories GetKeys lists at once
+func WithConcurrency(n int) Option {
+	return func(c *Client) { c.Concurrency = n }
+}
+
+// WithoutCache makes the client fetch everything every time
+func WithoutCache() Option {
+	return func(c *Client) { c.caches = nil }
+}
+
+// NewClient creates a client for the vault server at addr, e.g.
+// https://vault.example.com:8200. It caches what it fetches unless
+// WithoutCache is given.
+func NewClient(addr string, options ...Option) Client {
+	c := Client{
+		Addr:   addr,
+		caches: &caches{byToken: make(map[string]*cache)},
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// With returns a copy of the client with the options applied, e.g. one that
+// doesn't cache
+func (c Client) With(options ...Option) Client {
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// caches has a cache for each token that a client and its copies have used
+type caches struct {
+	mu      sync.Mutex
+	byToken map[string]*cache
+}
+
+// cache is the cache of the client's token, nil if the client doesn't cache
+func (c Client) cache() *cache {
+	if c.caches == nil {
+		return nil
+	}
+	c.caches.mu.Lock()
+	defer c.caches.mu.Unlock()
+	found, ok := c.caches.byToken[c.Token]
+	if !ok {
+		found = &cache{
+			keys:         make(map[string]discovery),
+			secrets:      make(map[string]Secret),
+			capabilities: make(map[string][]string),
+		}
+		c.caches.byToken[c.Token] = found
+	}
+	return found
+}
+
+// forget removes the secret and the keys of its mount from the caches of
+// all tokens, after the secret has been written
+func (c Client) forget(mount, name string) {
+	if c.caches == nil {
+		return
+	}
+	c.caches.mu.Lock()
+	defer c.caches.mu.Unlock()
+	for _, cache := range c.caches.byToken {
+		cache.forget(mount, name)
+	}
+}
+
+// cache holds what a client has fetched with one token, so that moving
+// around in the ui doesn't send the same requests again. It keeps its own
+// copies of keys and secrets, so callers may change what they get. Its
+// methods do nothing on a nil cache.
+type cache struct {
+	mu           sync.Mutex
+	keys         map[string]discovery
+	secrets      map[string]Secret
+	capabilities map[string][]string
+}
+
+func (c *cache) getKeys(mount string) (discovery, bool) {
+	if c == nil {
+		return discovery{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found, ok := c.keys[mount]
+	return found.clone(), ok
+}
+
+func (c *cache) setKeys(mount string, found discovery) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[mount] = found.clone()
+}
+
+func (c *cache) getSecret(path string) (Secret, bool) {
+	if c == nil {
+		return Secret{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	secret, ok := c.secrets[path]
+	return secret.clone(), ok
+}
+
+func (c *cache) setSecret(path string, secret Secret) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secrets[path] = secret.clone()
+}
+
+func (c *cache) forget(mount, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.secrets, mount+name)
+	delete(c.keys, mount)
+}
+
+// knownCapabilities returns the cached capabilities of the paths that have
+// them
+func (c *cache) knownCapabilities(paths []string) map[string][]string {
+	known := make(map[string][]string)
+	if c == nil {
+		return known
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, path := range paths {
+		if capabilities, found := c.capabilities[path]; found {
+			known[path] = capabilities
+		}
+	}
+	return known
+}
+
+func (c *cache) setCapabilities(capabilities map[string][]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path, cs := range capabilities {
+		c.capabilities[path] = cs
+	}
+}
+
+type dirEnt struct {
+	IsDir bool
+	Name  string
+}
+
+type discovery struct {
+	Keys   []string
+	Report Report
+}
+
+func (d discovery) clone() discovery {
+	return discovery{Keys: slices.Clone(d.Keys), Report: slices.Clone(d.Report)}
+}
+
+// ClearCache forgets everything fetched so far with every token, e.g. after
+// logging in with a new token
+func (c Client) ClearCache() {
+	if c.caches == nil {
+		return
+	}
+	c.caches.mu.Lock()
+	defer c.caches.mu.Unlock()
+	clear(c.caches.byToken)
+}
+
+// GetKeys finds all keys in the mount, like /app/db. Directories that can't
+// be listed are skipped and included in the report. An error is only
+// returned if the context is done before all keys have been found.
+func (c Client) GetKeys(ctx context.Context, mount string) ([]string, Report, error) {
+	if found, ok := c.cache().getKeys(mount); ok {
+		return found.Keys, found.Report, nil
+	}
+	entrypoint := dirEnt{
+		IsDir: true,
+		Name:  "/",
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_CONCURRENCY
+	}
+	limit := make(chan struct{}, concurrency)
+	recv := make(chan string)
+	report := reportCollector{}
+	go func() {
+		c.recurse(ctx, limit, recv, &report, mount, entrypoint)
+		close(recv)
+	}()
+	keys := []string{}
+	for key := range recv {
+		keys = append(keys, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to get keys in %s: %w", mount, err)
+	}
+	found := discovery{Keys: keys, Report: report.sorted()}
+	c.cache().setKeys(mount, found)
+	return found.Keys, found.Report, nil
+}
+
+// recurse sends the keys below entry to recv. At most cap(limit) directories
+// are listed at the same time.
+func (c Client) recurse(ctx context.Context, limit chan struct{}, recv chan string, report *reportCollector, mount string, entry dirEnt) {
+	if !entry.IsDir {
+		recv <- entry.Name
+		return
+	}
+	select {
+	case limit <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	relativeEntries, err := c.listDir(ctx, mount, entry.Name)
+	<-limit
+	if err != nil {
+		slog.Info("Failed to list directory", "directory", entry.Name, "err", err.Error())
+		report.add(entry.Name, err)
+		return
+	}
+	entries := []dirEnt{}
+	for _, sub := range relativeEntries {
+		entries = append(entries, dirEnt{
+			IsDir: sub.IsDir,
+			Name:  entry.Name + sub.Name,
+		})
+	}
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(entry dirEnt) {
+			defer wg.Done()
+			c.recurse(ctx, limit, recv, report, mount, e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (c Client) listDir(ctx context.Context, mount string, name string) ([]dirEnt, error) {
+	response, body, err := c.do(ctx, "GET", fmt.Sprintf("%s/metadata%s?list=true", mount, name), nil)
+	if err != nil {
+		return []dirEnt{}, err
+	}
+	if response.StatusCode != 200 {
+		return []dirEnt{}, responseError(response, body)
+	}
+	listResponse := struct {
+		Data struct {
+			Keys []string
+		}
+	}{}
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return []dirEnt{}, fmt.Errorf("Failed to parse response body %s: %s", string(body), err)
+	}
+	entries := []dirEnt{}
+	for _, key := range listResponse.Data.Keys {
+		e := dirEnt{Name: key}
+		if strings.HasSuffix(key, "/") {
+			e.IsDir = true
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Secret is the latest version of a kv v2 secret, with a link to it in the
+// vault ui and the vault cli command that reads it
+type Secret struct {
+	Url  string `json:"url"`
+	Cli  string `json:"cli"`
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata map[string]interface{} `json:"metadata"`
+	} `json:"data"`
+}
+
+// clone copies the data and metadata maps, their values are shared
+func (s Secret) clone() Secret {
+	s.Data.Data = maps.Clone(s.Data.Data)
+	s.Data.Metadata = maps.Clone(s.Data.Metadata)
+	return s
+}
+
+// GetSecret gets the latest version of the secret at name, like /app/db. A
+// deleted secret has metadata but no data.
+func (c Client) GetSecret(ctx context.Context, mount, name string) (Secret, error) {
+	if secret, found := c.cache().getSecret(mount + name); found {
+		return secret, nil
+	}
+	response, body, err := c.do(ctx, "GET", dataPath(mount, name), nil)
+	if err != nil {
+		return Secret{}, fmt.Errorf("Failed to get secret %s in %s: %w", name, mount, err)
+	}
+	var secret Secret
+	// The body has the values of the secret, which must not end up in
+	// error messages
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return Secret{}, fmt.Errorf("Failed to parse secret %s in %s: %s", name, mount, err)
+	}
+	// 404 can mean that the secret has been deleted, but it will still
+	// be listed. Supposedly all status codes above 400 return an
+	// error body. This is not true in this case. I guess we can look
+	// at the body and see if it has errors, if not the response is
+	// still valid and we can show the data.
+	// https://developer.hashicorp.com/vault/api-docs#error-response
+	isErrorForRealForReal := secret.Data.Data == nil && secret.Data.Metadata == nil
+	if response.StatusCode != 200 && isErrorForRealForReal {
+		return Secret{}, fmt.Errorf("Failed to get secret %s in %s: %w", name, mount, responseError(response, body))
+	}
+	secret.Url = fmt.Sprintf("%s/ui/vault/secrets/%s/show%s", c.Addr, mount, name)
+	secret.Cli = fmt.Sprintf("vault kv get -mount=%s %s", mount, name)
+	c.cache().setSecret(mount+name, secret)
+	return secret, nil
+}
+
+type mountsResponse struct {
+	Data struct {
+		Secret map[string]mountInfo
+	}
+}
+
+type mountInfo struct {
+	Type string
+}
+
+// GetMounts lists the kv mounts that the token can see
+func (c Client) GetMounts(ctx context.Context) ([]string, error) {
+	response, body, err := c.do(ctx, "GET", "sys/internal/ui/mounts", nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != 200 {
+		return nil, responseError(response, body)
+	}
+	var mounts mountsResponse
+	if err := json.Unmarshal(body, &mounts); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal response body %s: %s", string(body), err)
+	}
+	mountNames := []string{}
+	for k, v := range mounts.Data.Secret {
+		if v.Type == "kv" {
+			mountNames = append(mountNames, strings.TrimSuffix(k, "/"))
+		}
+	}
+	slices.Sort(mountNames)
+	return mountNames, nil
+}
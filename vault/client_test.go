@@ -0,0 +1,295 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+const token = "dev-only-token"
+
+func TestGetKeys(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	secrets := map[string]map[string]interface{}{
+		"/foo":     {"a": "b"},
+		"/bar/baz": {"c": "d"},
+		"/enterprise/organization/department/unit/team/user/actual-user": {"free": "palestine"},
+	}
+	for key, data := range secrets {
+		server.Put("secret", key, data)
+	}
+	vaultClient := Client{
+		Addr:  server.URL,
+		Token: token,
+	}
+	keys, report, err := vaultClient.GetKeys(context.Background(), "secret")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(report) > 0 {
+		t.Fatalf("Expected all paths to be readable, got %s", report)
+	}
+	if len(keys) != len(secrets) {
+		t.Fatalf("Expected %d keys, got %d", len(secrets), len(keys))
+	}
+	for key := range secrets {
+		if !slices.Contains(keys, key) {
+			t.Fatalf("Expected %s to be in keys %v", key, keys)
+		}
+	}
+}
+
+func TestGetKeysDenied(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/foo", map[string]interface{}{"a": "b"})
+	server.Put("secret", "/team/bar", map[string]interface{}{"c": "d"})
+	server.Deny("secret/metadata/team/")
+	vaultClient := Client{Addr: server.URL, Token: token}
+	keys, report, err := vaultClient.GetKeys(context.Background(), "secret")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if !slices.Equal(keys, []string{"/foo"}) {
+		t.Fatalf("Expected keys [/foo], got %v", keys)
+	}
+	if len(report) != 1 || report[0].Path != "/team/" || report[0].Reason != REASON_FORBIDDEN {
+		t.Fatalf("Expected /team/ to be forbidden, got %v", report)
+	}
+}
+
+func TestGetSecret(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/bar/baz", map[string]interface{}{"c": "d"})
+	vaultClient := Client{
+		Addr:  server.URL,
+		Token: token,
+	}
+	secret, err := vaultClient.GetSecret(context.Background(), "secret", "/bar/baz")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	data, found := secret.Data.Data["c"]
+	if !found || data != "d" {
+		t.Fatalf("Expected secret to have data `c=d`, got %v", secret.Data.Data)
+	}
+	expectedUrl := server.URL + "/ui/vault/secrets/secret/show/bar/baz"
+	if secret.Url != expectedUrl {
+		t.Fatalf("Expected url to be %s, got %s", expectedUrl, secret.Url)
+	}
+	expectedCli := "vault kv get -mount=secret /bar/baz"
+	if secret.Cli != expectedCli {
+		t.Fatalf("Expected cli command to be %s, got %s", expectedCli, secret.Cli)
+	}
+}
+
+func TestCacheIsPerToken(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/bar/baz", map[string]interface{}{"c": "d"})
+	vaultClient := NewClient(server.URL, WithToken(token))
+	if _, err := vaultClient.GetSecret(context.Background(), "secret", "/bar/baz"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, _, err := vaultClient.GetKeys(context.Background(), "secret"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	other := vaultClient
+	other.Token = "other-token"
+	if secret, err := other.GetSecret(context.Background(), "secret", "/bar/baz"); err == nil {
+		t.Fatalf("Expected the other token to be denied, got the cached secret %v", secret.Data.Data)
+	}
+	if keys, _, _ := other.GetKeys(context.Background(), "secret"); len(keys) > 0 {
+		t.Fatalf("Expected the other token to find no keys, got the cached keys %v", keys)
+	}
+}
+
+func TestCacheKeepsItsOwnCopies(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/b", map[string]interface{}{"c": "d"})
+	server.Put("secret", "/a", map[string]interface{}{"e": "f"})
+	vaultClient := NewClient(server.URL, WithToken(token))
+	keys, _, err := vaultClient.GetKeys(context.Background(), "secret")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := slices.Clone(keys)
+	keys[0] = "/changed"
+	if keys, _, _ := vaultClient.GetKeys(context.Background(), "secret"); !slices.Equal(keys, expected) {
+		t.Fatalf("Expected the cached keys to be %v, got %v", expected, keys)
+	}
+	secret, err := vaultClient.GetSecret(context.Background(), "secret", "/b")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	secret.Data.Data["c"] = "changed"
+	if secret, _ := vaultClient.GetSecret(context.Background(), "secret", "/b"); secret.Data.Data["c"] != "d" {
+		t.Fatalf("Expected the cached secret to have data `c=d`, got %v", secret.Data.Data)
+	}
+}
+
+func TestGetSecretDeleted(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/old", map[string]interface{}{"c": "d"})
+	server.Delete("secret", "/old", 1)
+	vaultClient := Client{Addr: server.URL, Token: token}
+	secret, err := vaultClient.GetSecret(context.Background(), "secret", "/old")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if secret.Data.Data != nil {
+		t.Fatalf("Expected a deleted secret to have no data, got %v", secret.Data.Data)
+	}
+	if secret.Data.Metadata["deletion_time"] == "" {
+		t.Fatalf("Expected a deleted secret to have a deletion time, got %v", secret.Data.Metadata)
+	}
+}
+
+func TestGetKeysConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/v1/kv/metadata/" {
+			keys := ""
+			for i := range 20 {
+				keys += fmt.Sprintf(`"dir-%d/",`, i)
+			}
+			fmt.Fprintf(w, `{"data": {"keys": [%s"key"]}}`, keys)
+			return
+		}
+		w.Write([]byte(`{"data": {"keys": ["key"]}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, WithConcurrency(3))
+	keys, _, err := client.GetKeys(context.Background(), "kv")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(keys) != 21 {
+		t.Fatalf("Expected 21 keys, got %d", len(keys))
+	}
+	if maxInFlight.Load() > 3 {
+		t.Fatalf("Expected at most 3 requests at once, got %d", maxInFlight.Load())
+	}
+}
+
+func TestGetKeysCancelled(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/a/b", map[string]interface{}{"c": "d"})
+	server.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := NewClient(server.URL, WithToken(token))
+	start := time.Now()
+	if _, _, err := client.GetKeys(ctx, "secret"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Expected GetKeys to return when the context is done, it took %s", time.Since(start))
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.SetLatency(200 * time.Millisecond)
+	vaultClient := Client{Addr: server.URL, Token: token, HTTPClient: server.Client()}
+	vaultClient.HTTPClient.Timeout = 50 * time.Millisecond
+	if _, err := vaultClient.GetMounts(context.Background()); err == nil {
+		t.Fatalf("Expected a slow response to time out")
+	}
+	vaultClient.HTTPClient.Timeout = time.Second
+	mounts, err := vaultClient.GetMounts(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if !slices.Equal(mounts, []string{"secret"}) {
+		t.Fatalf("Expected mounts [secret], got %v", mounts)
+	}
+}
+
+func TestLoginAppRole(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.AddLogin("ci-approle", func(body map[string]string) bool {
+		return body["role_id"] == "role" && body["secret_id"] == "secret"
+	})
+	vaultClient := Client{Addr: server.URL}
+	newToken, err := vaultClient.LoginAppRole(context.Background(), "ci-approle", "role", "secret")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	vaultClient.Token = newToken
+	if _, err := vaultClient.LookupSelf(context.Background()); err != nil {
+		t.Fatalf("Expected the new token to be valid, got %s", err)
+	}
+	if _, err := vaultClient.LoginAppRole(context.Background(), "ci-approle", "role", "wrong"); err == nil {
+		t.Fatalf("Expected login with the wrong secret_id to fail")
+	}
+}
+
+func TestLoginJWT(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	jwt := "header.payload.signature"
+	server.AddLogin("jwt", func(body map[string]string) bool {
+		return body["role"] == "ci" && body["jwt"] == jwt
+	})
+	vaultClient := Client{Addr: server.URL}
+	newToken, err := vaultClient.LoginJWT(context.Background(), "jwt", "ci", jwt)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	vaultClient.Token = newToken
+	info, err := vaultClient.LookupSelf(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the new token to be valid, got %s", err)
+	}
+	if !slices.Contains(info.Policies, "default") {
+		t.Fatalf("Expected the token to have the default policy, got %v", info.Policies)
+	}
+	if _, err := vaultClient.LoginJWT(context.Background(), "jwt", "admin", jwt); err == nil {
+		t.Fatalf("Expected login with the wrong role to fail")
+	}
+}
+
+func TestLoginUserpass(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.AddLogin("userpass", func(body map[string]string) bool {
+		return body["username"] == "alice" && body["password"] == "pw"
+	})
+	vaultClient := Client{Addr: server.URL}
+	if _, err := vaultClient.LoginUserpass(context.Background(), "userpass", "alice", "pw"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, err := vaultClient.LoginUserpass(context.Background(), "userpass", "bob", "pw"); err == nil {
+		t.Fatalf("Expected login as another user to fail")
+	}
+	// Unescaped, the rest of the name would be the query
+	if _, err := vaultClient.LoginUserpass(context.Background(), "userpass", "alice?x", "pw"); err == nil {
+		t.Fatalf("Expected the whole username to be in the path")
+	}
+}
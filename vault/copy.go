@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrCheckAndSet is returned when a secret is written with check-and-set
+// and its current version is not the expected one
+var ErrCheckAndSet = errors.New("The secret has changed or exists")
+
+// PutSecretCAS writes a new version of the secret if its current version is
+// cas. A cas of 0 means that the secret must not exist. Errors wrap
+// ErrCheckAndSet if the version didn't match.
+func (c Client) PutSecretCAS(ctx context.Context, mount, name string, data map[string]interface{}, cas int) error {
+	body := map[string]any{
+		"data":    data,
+		"options": map[string]any{"cas": cas},
+	}
+	err := c.doJSON(ctx, "POST", dataPath(mount, name), body, nil)
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusBadRequest && slices.ContainsFunc(responseErr.Errors, func(e string) bool {
+		return strings.Contains(e, "check-and-set")
+	}) {
+		return fmt.Errorf("Failed to write secret %s in %s: %w", name, mount, ErrCheckAndSet)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write secret %s in %s: %s", name, mount, err)
+	}
+	c.forget(mount, name)
+	return nil
+}
+
+// DeleteAllVersions permanently deletes the secret with all of its versions
+// and its metadata
+func (c Client) DeleteAllVersions(ctx context.Context, mount, name string) error {
+	if err := c.doJSON(ctx, "DELETE", metadataPath(mount, name), nil, nil); err != nil {
+		return fmt.Errorf("Failed to delete secret %s in %s: %s", name, mount, err)
+	}
+	c.forget(mount, name)
+	return nil
+}
+
+// CopyOptions change what Copy and CopyTree do
+type CopyOptions struct {
+	// Metadata copies the custom metadata as well
+	Metadata bool
+	// Overwrite writes over secrets that exist at the destination. Without
+	// it, copying to an existing secret fails with ErrCheckAndSet.
+	Overwrite bool
+	// Move deletes the source with all of its versions after it has been
+	// written
+	Move bool
+}
+
+// CopyResult tells how copying one secret went
+type CopyResult struct {
+	From string
+	To   string
+	// Err is nil if the secret was copied
+	Err error
+}
+
+// Copy copies the latest version of the secret at fromName in fromMount to
+// toName in toMount. For moves, the source is deleted only if the copy
+// was written.
+func (c Client) Copy(ctx context.Context, fromMount, fromName, toMount, toName string, options CopyOptions) error {
+	if fromMount == toMount && fromName == toName {
+		return fmt.Errorf("Failed to copy %s in %s, the source and destination are the same", fromName, fromMount)
+	}
+	// The cached secret may be outdated
+	uncached := c
+	uncached.caches = nil
+	secret, err := uncached.GetSecret(ctx, fromMount, fromName)
+	if err != nil {
+		return err
+	}
+	if secret.Data.Data == nil {
+		return fmt.Errorf("Failed to copy %s in %s, its latest version is deleted", fromName, fromMount)
+	}
+	if options.Overwrite {
+		err = c.PutSecret(ctx, toMount, toName, secret.Data.Data)
+	} else {
+		err = c.PutSecretCAS(ctx, toMount, toName, secret.Data.Data, 0)
+	}
+	if err != nil {
+		return err
+	}
+	if options.Metadata {
+		metadata, err := c.GetMetadata(ctx, fromMount, fromName)
+		if err != nil {
+			return err
+		}
+		if err := c.PutCustomMetadata(ctx, toMount, toName, metadata.CustomMetadata); err != nil {
+			return err
+		}
+	}
+	if options.Move {
+		return c.DeleteAllVersions(ctx, fromMount, fromName)
+	}
+	return nil
+}
+
+// CopyTree copies the secrets below fromPrefix, like /app/, to the same
+// paths below toPrefix. It returns a result for each secret, the error is
+// only for failing to find the secrets.
+func (c Client) CopyTree(ctx context.Context, fromMount, fromPrefix, toMount, toPrefix string, options CopyOptions) ([]CopyResult, error) {
+	fromPrefix = strings.TrimSuffix(fromPrefix, "/") + "/"
+	toPrefix = strings.TrimSuffix(toPrefix, "/") + "/"
+	if fromMount == toMount && strings.HasPrefix(toPrefix, fromPrefix) {
+		return nil, fmt.Errorf("Failed to copy %s in %s, the destination %s is inside it", fromPrefix, fromMount, toPrefix)
+	}
+	keys, _, err := c.GetKeys(ctx, fromMount)
+	if err != nil {
+		return nil, err
+	}
+	results := []CopyResult{}
+	for _, key := range keys {
+		if rest, found := strings.CutPrefix(key, fromPrefix); found {
+			results = append(results, CopyResult{From: key, To: toPrefix + rest})
+		}
+	}
+	slices.SortFunc(results, func(a, b CopyResult) int {
+		return strings.Compare(a.From, b.From)
+	})
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_CONCURRENCY
+	}
+	limit := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		result := &results[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return
+			}
+			defer func() { <-limit }()
+			result.Err = c.Copy(ctx, fromMount, result.From, toMount, result.To, options)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+func TestCopy(t *testing.T) {
+	tests := map[string]struct {
+		options CopyOptions
+		// to is the destination in the kv mount
+		to string
+		// expected is the data at the destination after copying
+		expected string
+		err      error
+		deleted  bool
+		metadata bool
+	}{
+		"copy":                 {to: "/new", expected: "db"},
+		"existing":             {to: "/existing", expected: "old", err: ErrCheckAndSet},
+		"overwrite":            {options: CopyOptions{Overwrite: true}, to: "/existing", expected: "db"},
+		"move":                 {options: CopyOptions{Move: true}, to: "/new", expected: "db", deleted: true},
+		"move to existing":     {options: CopyOptions{Move: true}, to: "/existing", expected: "old", err: ErrCheckAndSet},
+		"with custom metadata": {options: CopyOptions{Metadata: true}, to: "/new", expected: "db", metadata: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := vaulttest.NewServer(token)
+			defer server.Close()
+			server.Put("secret", "/app/db", map[string]interface{}{"name": "db"})
+			server.SetCustomMetadata("secret", "/app/db", map[string]string{"owner": "team"})
+			server.Put("kv", "/existing", map[string]interface{}{"name": "old"})
+			client := NewClient(server.URL, WithToken(token), WithoutCache())
+
+			err := client.Copy(context.Background(), "secret", "/app/db", "kv", test.to, test.options)
+			if test.err == nil && err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("Expected error %s, got %v", test.err, err)
+			}
+			secret, err := client.GetSecret(context.Background(), "kv", test.to)
+			if err != nil {
+				t.Fatalf("Failed to get the destination: %s", err)
+			}
+			if secret.Data.Data["name"] != test.expected {
+				t.Fatalf("Expected %s at the destination, got %v", test.expected, secret.Data.Data)
+			}
+			_, err = client.GetSecret(context.Background(), "secret", "/app/db")
+			if test.deleted != (err != nil) {
+				t.Fatalf("Expected the source to be deleted: %t, got error %v", test.deleted, err)
+			}
+			if test.err != nil {
+				return
+			}
+			metadata, err := client.GetMetadata(context.Background(), "kv", test.to)
+			if err != nil {
+				t.Fatalf("Failed to get metadata: %s", err)
+			}
+			if test.metadata != (metadata.CustomMetadata["owner"] == "team") {
+				t.Fatalf("Expected custom metadata to be copied: %t, got %v", test.metadata, metadata.CustomMetadata)
+			}
+		})
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	for _, key := range []string{"/app/db", "/app/api/key", "/application", "/other"} {
+		server.Put("secret", key, map[string]interface{}{"key": key})
+	}
+	server.Put("secret", "/team/app/db", map[string]interface{}{"key": "existing"})
+	client := NewClient(server.URL, WithToken(token), WithConcurrency(2))
+
+	results, err := client.CopyTree(context.Background(), "secret", "/app", "secret", "/team/app/", CopyOptions{Move: true})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	copied := []string{}
+	for _, result := range results {
+		if result.Err == nil {
+			copied = append(copied, result.From+" "+result.To)
+		} else if !errors.Is(result.Err, ErrCheckAndSet) {
+			t.Fatalf("Got unexpected error for %s: %s", result.From, result.Err)
+		}
+	}
+	if !slices.Equal(copied, []string{"/app/api/key /team/app/api/key"}) {
+		t.Fatalf("Expected only /app/api/key to be moved, got %v", copied)
+	}
+	keys, _, err := client.GetKeys(context.Background(), "secret")
+	if err != nil {
+		t.Fatalf("Failed to get keys: %s", err)
+	}
+	slices.Sort(keys)
+	expected := []string{"/app/db", "/application", "/other", "/team/app/api/key", "/team/app/db"}
+	if !slices.Equal(keys, expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, keys)
+	}
+	if _, err := client.CopyTree(context.Background(), "secret", "/app/", "secret", "/app/backup/", CopyOptions{}); err == nil {
+		t.Fatalf("Expected an error when copying into the source")
+	}
+}
@@ -0,0 +1,18 @@
+// Package vault is a client for the kv v2 secrets engine of HashiCorp Vault.
+// It finds all keys in a mount by listing it recursively, reads and writes
+// secrets and their versions, checks capabilities, and logs in and keeps
+// tokens alive.
+//
+// Every method that talks to vault takes a context and returns an error.
+// Requests that fail with 412, 429 or 5xx are retried with backoff, see
+// VAULT_MAX_RETRIES. A Client caches what it fetches and is safe for
+// concurrent use. Create one with NewClient and configure it with options:
+//
+//	client := vault.NewClient("https://vault.example.com:8200",
+//		vault.WithToken(token),
+//		vault.WithConcurrency(8),
+//	)
+//	keys, report, err := client.GetKeys(ctx, "secret")
+//
+// The token can be found like the vault cli does with FindToken.
+package vault
@@ -0,0 +1,78 @@
+package vault_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/slarwise/pole/vault"
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+func ExampleClient_GetKeys() {
+	server := vaulttest.NewServer("root")
+	defer server.Close()
+	server.Put("secret", "/app/db", map[string]interface{}{"password": "hunter2"})
+	server.Put("secret", "/app/api", map[string]interface{}{"key": "abc"})
+	server.Put("secret", "/team/readme", map[string]interface{}{"text": "hi"})
+	server.Deny("secret/metadata/team/")
+
+	client := vault.NewClient(server.URL, vault.WithToken("root"), vault.WithConcurrency(4))
+	keys, report, err := client.GetKeys(context.Background(), "secret")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	slices.Sort(keys)
+	fmt.Println(keys)
+	for _, unreadable := range report {
+		fmt.Println(unreadable.Reason, unreadable.Path)
+	}
+	// Output:
+	// [/app/api /app/db]
+	// forbidden /team/
+}
+
+func ExampleClient_GetSecret() {
+	server := vaulttest.NewServer("root")
+	defer server.Close()
+	server.Put("secret", "/app/db", map[string]interface{}{"password": "hunter2"})
+
+	client := vault.NewClient(server.URL, vault.WithToken("root"))
+	secret, err := client.GetSecret(context.Background(), "secret", "/app/db")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(secret.Data.Data["password"])
+	fmt.Println(secret.Cli)
+	// Output:
+	// hunter2
+	// vault kv get -mount=secret /app/db
+}
+
+func ExampleClient_GetVersions() {
+	server := vaulttest.NewServer("root")
+	defer server.Close()
+	ctx := context.Background()
+	client := vault.NewClient(server.URL, vault.WithToken("root"))
+	for _, password := range []string{"first", "second"} {
+		if err := client.PutSecret(ctx, "secret", "/app/db", map[string]interface{}{"password": password}); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	versions, err := client.GetVersions(ctx, "secret", "/app/db")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	first, err := client.GetSecretVersion(ctx, "secret", "/app/db", versions[0].Version)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(len(versions), first.Data.Data["password"])
+	// Output:
+	// 2 first
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// EXPIRY_WARNING is how long before a token that can't be renewed
+	// expires that a warning is given
+	EXPIRY_WARNING = 5 * time.Minute
+	// WATCH_INTERVAL is how often the status of the token is reported, so
+	// that the remaining ttl can be shown
+	WATCH_INTERVAL = 10 * time.Second
+)
+
+// TokenStatus describes the token at one point in time
+type TokenStatus struct {
+	Info TokenInfo
+	// Expires is the zero time for tokens that never expire
+	Expires time.Time
+	Warning string
+}
+
+// Remaining returns how long is left until the token expires
+func (s TokenStatus) Remaining() time.Duration {
+	if s.Expires.IsZero() {
+		return 0
+	}
+	return max(time.Until(s.Expires), 0)
+}
+
+// WatchToken renews the token in the background when a third of its ttl is
+// left. Tokens that are not renewable, or that can't be renewed any longer,
+// get a warning shortly before they expire. notify is called with the status
+// of the token every WATCH_INTERVAL and whenever it changes. Watching stops
+// when the context is done.
+func (c Client) WatchToken(ctx context.Context, info TokenInfo, notify func(TokenStatus)) {
+	status := newTokenStatus(info)
+	go func() {
+		ticker := time.NewTicker(WATCH_INTERVAL)
+		defer ticker.Stop()
+		renewable := info.Renewable
+		ttl := time.Duration(info.TTL) * time.Second
+		for {
+			notify(status)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if status.Expires.IsZero() {
+				continue
+			}
+			remaining := status.Remaining()
+			if renewable && remaining <= ttl/3 {
+				newTTL, err := c.RenewSelf(ctx)
+				if err != nil {
+					slog.Error("Failed to renew token", "err", err)
+					status.Warning = fmt.Sprintf("Failed to renew token: %s", err)
+					renewable = false
+					continue
+				}
+				newExpires := time.Now().Add(time.Duration(newTTL) * time.Second)
+				if !newExpires.After(status.Expires) {
+					// The max ttl has been reached
+					renewable = false
+				}
+				slog.Info("Renewed token", "ttl", newTTL)
+				ttl = time.Duration(newTTL) * time.Second
+				status.Expires = newExpires
+				status.Warning = ""
+				remaining = status.Remaining()
+			}
+			if !renewable && remaining == 0 {
+				status.Warning = "Token has expired"
+			} else if !renewable && remaining <= EXPIRY_WARNING {
+				status.Warning = fmt.Sprintf("Token expires in %s", remaining.Round(time.Second))
+			}
+		}
+	}()
+}
+
+func newTokenStatus(info TokenInfo) TokenStatus {
+	status := TokenStatus{Info: info}
+	if info.TTL > 0 {
+		status.Expires = time.Now().Add(time.Duration(info.TTL) * time.Second)
+	}
+	return status
+}
@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Reason string
+
+const (
+	REASON_FORBIDDEN Reason = "forbidden"
+	REASON_FAILED    Reason = "failed"
+	REASON_TIMEOUT   Reason = "timeout"
+)
+
+// Unreadable is a directory that could not be listed when discovering keys.
+// Keys below it are missing from the result.
+type Unreadable struct {
+	Path   string `json:"path"`
+	Reason Reason `json:"reason"`
+	Err    string `json:"error"`
+}
+
+// Report lists the directories that could not be listed when discovering
+// keys
+type Report []Unreadable
+
+func newUnreadable(path string, err error) Unreadable {
+	reason := REASON_FAILED
+	var netErr net.Error
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == 403 {
+		reason = REASON_FORBIDDEN
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		reason = REASON_TIMEOUT
+	}
+	return Unreadable{Path: path, Reason: reason, Err: err.Error()}
+}
+
+// String formats the report with one path per line
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d paths not readable:\n", len(r))
+	for _, u := range r {
+		fmt.Fprintf(&b, "  %-9s %s: %s\n", u.Reason, u.Path, u.Err)
+	}
+	return b.String()
+}
+
+// reportCollector gathers unreadable paths from concurrent listings
+type reportCollector struct {
+	mu     sync.Mutex
+	report Report
+}
+
+func (r *reportCollector) add(path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report = append(r.report, newUnreadable(path, err))
+}
+
+func (r *reportCollector) sorted() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := slices.Clone(r.report)
+	slices.SortFunc(report, func(a, b Unreadable) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return report
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestGetKeysReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/report/metadata/":
+			w.Write([]byte(`{"data": {"keys": ["readable", "forbidden/", "broken/"]}}`))
+		case "/v1/report/metadata/forbidden/":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	client := Client{Addr: server.URL}
+	keys, report, err := client.GetKeys(context.Background(), "report")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if !slices.Equal(keys, []string{"/readable"}) {
+		t.Fatalf("Expected keys [/readable], got %v", keys)
+	}
+	if len(report) != 2 {
+		t.Fatalf("Expected 2 unreadable paths, got %v", report)
+	}
+	expected := []struct {
+		path   string
+		reason Reason
+	}{
+		{"/broken/", REASON_FAILED},
+		{"/forbidden/", REASON_FORBIDDEN},
+	}
+	for i, e := range expected {
+		if report[i].Path != e.path || report[i].Reason != e.reason {
+			t.Fatalf("Expected %s to be %s, got %v", e.path, e.reason, report[i])
+		}
+	}
+}
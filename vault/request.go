@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_RETRIES = 2
+	RETRY_BASE_DELAY    = 250 * time.Millisecond
+	RETRY_MAX_DELAY     = 10 * time.Second
+	REQUEST_TIMEOUT     = 30 * time.Second
+)
+
+var defaultHTTPClient = &http.Client{Timeout: REQUEST_TIMEOUT}
+
+// requestCount is the number of requests sent to vault, including retries
+var requestCount atomic.Int64
+
+// do sends a request to the vault api at path, e.g. `sys/internal/ui/mounts`.
+// Reads that get status 412, 429 or 5xx or that fail are retried with
+// jittered exponential backoff, up to VAULT_MAX_RETRIES times. Writes are
+// never retried, they may have been applied even if the response is lost. The
+// response is returned for all status codes, the caller must check it. The
+// response body has already been read and closed. Waiting for a retry stops
+// when the context is done.
+func (c Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	url := fmt.Sprintf("%s/v1/%s", c.Addr, path)
+	retries := maxRetries()
+	for attempt := 0; ; attempt++ {
+		var requestBody io.Reader
+		if body != nil {
+			requestBody = bytes.NewReader(body)
+		}
+		request, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to create request: %s", err)
+		}
+		if c.Token != "" {
+			request.Header.Set("X-Vault-Token", c.Token)
+		}
+		if c.Namespace != "" {
+			request.Header.Set("X-Vault-Namespace", c.Namespace)
+		}
+		request.Header.Set("Accept", "application/json")
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		count := requestCount.Add(1)
+		httpClient := c.HTTPClient
+		if httpClient == nil {
+			httpClient = defaultHTTPClient
+		}
+		response, err := httpClient.Do(request)
+		var responseBody []byte
+		if err == nil {
+			responseBody, err = io.ReadAll(response.Body)
+			response.Body.Close()
+			if err != nil {
+				err = fmt.Errorf("Failed to read response body: %w", err)
+			}
+		} else {
+			err = fmt.Errorf("Failed to perform request: %w", err)
+		}
+		if err != nil {
+			slog.Debug("Vault request", "method", method, "url", url, "attempt", attempt+1, "requests", count, "err", err)
+		} else {
+			slog.Debug("Vault request", "method", method, "url", url, "attempt", attempt+1, "requests", count, "status", response.StatusCode)
+		}
+		if attempt >= retries || !isRead(method) || !shouldRetry(response, err) {
+			return response, responseBody, err
+		}
+		delay := retryDelay(attempt, response)
+		slog.Info("Retrying vault request", "method", method, "url", url, "attempt", attempt+1, "delay", delay, "status", statusOf(response), "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return response, responseBody, err
+		}
+	}
+}
+
+// isRead is true for the methods that don't change anything in vault, which
+// can be sent again
+func isRead(method string) bool {
+	return method == "GET" || method == "LIST"
+}
+
+func shouldRetry(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch {
+	case response.StatusCode == http.StatusPreconditionFailed,
+		response.StatusCode == http.StatusTooManyRequests,
+		response.StatusCode >= 500 && response.StatusCode != http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// retryDelay is the Retry-After of the response if it has one, otherwise
+// an exponentially growing delay with jitter
+func retryDelay(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+				return min(time.Duration(seconds)*time.Second, RETRY_MAX_DELAY)
+			}
+			if date, err := http.ParseTime(retryAfter); err == nil {
+				return min(max(time.Until(date), 0), RETRY_MAX_DELAY)
+			}
+		}
+	}
+	// Doubled step by step, since shifting by a large attempt overflows
+	backoff := RETRY_BASE_DELAY
+	for range attempt {
+		if backoff >= RETRY_MAX_DELAY {
+			break
+		}
+		backoff *= 2
+	}
+	backoff = min(backoff, RETRY_MAX_DELAY)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// maxRetries reads VAULT_MAX_RETRIES, which is also used by the vault cli
+func maxRetries() int {
+	value, found := os.LookupEnv("VAULT_MAX_RETRIES")
+	if !found {
+		return DEFAULT_MAX_RETRIES
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		slog.Error("VAULT_MAX_RETRIES must be a non-negative integer, using the default", "value", value, "default", DEFAULT_MAX_RETRIES)
+		return DEFAULT_MAX_RETRIES
+	}
+	return retries
+}
+
+func statusOf(response *http.Response) int {
+	if response == nil {
+		return 0
+	}
+	return response.StatusCode
+}
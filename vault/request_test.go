@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoRetries(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		statuses   []int
+		maxRetries string
+		status     int
+		requests   int
+	}{
+		"no-retry-on-success": {
+			statuses: []int{200},
+			status:   200,
+			requests: 1,
+		},
+		"no-retry-on-forbidden": {
+			statuses: []int{403, 200},
+			status:   403,
+			requests: 1,
+		},
+		"retry-on-unavailable": {
+			statuses: []int{503, 503, 200},
+			status:   200,
+			requests: 3,
+		},
+		"retry-on-rate-limit": {
+			statuses: []int{429, 412, 200},
+			status:   200,
+			requests: 3,
+		},
+		"give-up": {
+			statuses: []int{500, 500, 500, 200},
+			status:   500,
+			requests: 3,
+		},
+		"max-retries-from-env": {
+			statuses:   []int{500, 500, 500, 200},
+			maxRetries: "3",
+			status:     200,
+			requests:   4,
+		},
+		"no-retry-on-write": {
+			method:   "POST",
+			statuses: []int{503, 200},
+			status:   503,
+			requests: 1,
+		},
+		"no-retries": {
+			statuses:   []int{500, 200},
+			maxRetries: "0",
+			status:     500,
+			requests:   1,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.maxRetries != "" {
+				t.Setenv("VAULT_MAX_RETRIES", test.maxRetries)
+			}
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+			client := Client{Addr: server.URL}
+			response, _, err := client.do(context.Background(), method, "sys/health", nil)
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if response.StatusCode != test.status {
+				t.Fatalf("Expected status %d, got %d", test.status, response.StatusCode)
+			}
+			if requests != test.requests {
+				t.Fatalf("Expected %d requests, got %d", test.requests, requests)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	response := &http.Response{Header: http.Header{}}
+	response.Header.Set("Retry-After", "3")
+	if delay := retryDelay(0, response); delay != 3*time.Second {
+		t.Fatalf("Expected the delay to follow Retry-After, got %s", delay)
+	}
+	for attempt := range 10 {
+		delay := retryDelay(attempt, nil)
+		backoff := min(RETRY_BASE_DELAY<<attempt, RETRY_MAX_DELAY)
+		if delay < backoff/2 || delay > backoff {
+			t.Fatalf("Expected the delay for attempt %d to be between %s and %s, got %s", attempt, backoff/2, backoff, delay)
+		}
+	}
+	for _, attempt := range []int{36, 64, 1000} {
+		delay := retryDelay(attempt, nil)
+		if delay < RETRY_MAX_DELAY/2 || delay > RETRY_MAX_DELAY {
+			t.Fatalf("Expected the delay for attempt %d to be between %s and %s, got %s", attempt, RETRY_MAX_DELAY/2, RETRY_MAX_DELAY, delay)
+		}
+	}
+}
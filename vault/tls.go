@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig says how to verify the certificate of the vault server and which
+// client certificate to present, like VAULT_CACERT, VAULT_CLIENT_CERT,
+// VAULT_CLIENT_KEY, VAULT_TLS_SERVER_NAME and VAULT_SKIP_VERIFY do for the
+// vault cli
+type TLSConfig struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	ServerName string
+	SkipVerify bool
+}
+
+// HTTPClient creates an http client that uses the tls config. It returns nil
+// if the config is empty, the client then uses its default http client.
+func (t TLSConfig) HTTPClient() (*http.Client, error) {
+	if t == (TLSConfig{}) {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.SkipVerify,
+	}
+	if t.CACert != "" {
+		pem, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Found no certificates in %s", t.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport, Timeout: REQUEST_TIMEOUT}, nil
+}
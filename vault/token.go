@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FindToken resolves a vault token the same way the vault cli does. The
+// VAULT_TOKEN environment variable takes precedence. Otherwise the token
+// helper configured in ~/.vault (or VAULT_CONFIG_PATH) is asked, and if no
+// helper is configured the token is read from ~/.vault-token, which is what
+// the default helper used by `vault login` writes to. The returned source
+// describes where the token came from.
+func FindToken() (token string, source string, err error) {
+	if token, found := os.LookupEnv("VAULT_TOKEN"); found {
+		if token == "" {
+			return "", "VAULT_TOKEN", errors.New("VAULT_TOKEN is set but empty")
+		}
+		return token, "VAULT_TOKEN", nil
+	}
+	helper, configPath, err := configuredTokenHelper()
+	if err != nil {
+		return "", configPath, err
+	}
+	if helper != "" {
+		token, source, err := tokenFromHelper(helper)
+		if err != nil {
+			return "", source, fmt.Errorf("%s, the helper is configured in %s", err, configPath)
+		}
+		return token, source, nil
+	}
+	tokenFile, err := tokenFilePath()
+	if err != nil {
+		return "", "token file", err
+	}
+	if _, err := os.Stat(tokenFile); errors.Is(err, os.ErrNotExist) {
+		return "", tokenFile, fmt.Errorf("No vault token found: VAULT_TOKEN is not set, no token_helper is configured in %s and %s does not exist. Run `vault login` or set VAULT_TOKEN", configPath, tokenFile)
+	}
+	return tokenFromFile(tokenFile)
+}
+
+// TokenSource says where to find a token. Only one of the fields should be
+// set. The zero value finds the token like the vault cli does, see
+// FindToken.
+type TokenSource struct {
+	// Env is the name of an environment variable holding the token
+	Env    string
+	File   string
+	Helper string
+	// Token is the token itself, for programs that already have it
+	Token string
+}
+
+// Find gets the token from the source. The returned source describes where
+// the token came from.
+func (s TokenSource) Find() (token string, source string, err error) {
+	switch {
+	case s.Token != "":
+		return s.Token, "the given token", nil
+	case s.Env != "":
+		token := os.Getenv(s.Env)
+		if token == "" {
+			return "", s.Env, fmt.Errorf("No vault token found: %s is not set", s.Env)
+		}
+		return token, s.Env, nil
+	case s.Helper != "":
+		return tokenFromHelper(s.Helper)
+	case s.File != "":
+		return tokenFromFile(s.File)
+	}
+	return FindToken()
+}
+
+// Store saves the token so that Find finds it next time. The returned
+// destination describes where it was saved.
+func (s TokenSource) Store(token string) (destination string, err error) {
+	switch {
+	case s.Token != "":
+		return "the given token", fmt.Errorf("Can't save the token, the source is a given token")
+	case s.Env != "":
+		return s.Env, fmt.Errorf("Can't save the token to the environment variable %s", s.Env)
+	case s.Helper != "":
+		return storeWithHelper(s.Helper, token)
+	case s.File != "":
+		return storeInFile(s.File, token)
+	}
+	return StoreToken(token)
+}
+
+func tokenFromHelper(helper string) (token string, source string, err error) {
+	source = fmt.Sprintf("token helper %s", helper)
+	token, err = runTokenHelper(helper, "get", "")
+	if err != nil {
+		return "", source, fmt.Errorf("Failed to get token from token helper %s: %s", helper, err)
+	}
+	if token == "" {
+		return "", source, fmt.Errorf("Token helper %s returned no token, run `vault login` first", helper)
+	}
+	return token, source, nil
+}
+
+func tokenFromFile(path string) (token string, source string, err error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", path, fmt.Errorf("Failed to read token file %s: %s", path, err)
+	}
+	token = strings.TrimSpace(string(bytes))
+	if token == "" {
+		return "", path, fmt.Errorf("Token file %s is empty, run `vault login` first", path)
+	}
+	return token, path, nil
+}
+
+var tokenHelperRegexp = regexp.MustCompile(`^\s*token_helper\s*=\s*"(.*)"\s*$`)
+
+// configuredTokenHelper returns the token_helper set in the vault cli config
+// file together with the path of that file. An empty helper means that none
+// is configured.
+func configuredTokenHelper() (helper string, configPath string, err error) {
+	configPath, found := os.LookupEnv("VAULT_CONFIG_PATH")
+	if !found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "~/.vault", fmt.Errorf("Failed to find the home directory: %s", err)
+		}
+		configPath = filepath.Join(home, ".vault")
+	}
+	file, err := os.Open(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", configPath, nil
+	} else if err != nil {
+		return "", configPath, fmt.Errorf("Failed to read vault config %s: %s", configPath, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := tokenHelperRegexp.FindStringSubmatch(scanner.Text()); match != nil {
+			helper = match[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", configPath, fmt.Errorf("Failed to read vault config %s: %s", configPath, err)
+	}
+	if helper != "" && !filepath.IsAbs(helper) {
+		return "", configPath, fmt.Errorf("The token_helper %s in %s must be an absolute path", helper, configPath)
+	}
+	return helper, configPath, nil
+}
+
+func tokenFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find the home directory: %s", err)
+	}
+	return filepath.Join(home, ".vault-token"), nil
+}
+
+// runTokenHelper runs a token helper with the given operation, see
+// https://developer.hashicorp.com/vault/docs/commands/token-helper
+func runTokenHelper(helper, op, stdin string) (string, error) {
+	cmd := exec.Command(helper, op)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// StoreToken saves the token where FindToken looks for it, in the configured
+// token helper or in ~/.vault-token. The returned destination describes
+// where it was saved.
+func StoreToken(token string) (destination string, err error) {
+	helper, configPath, err := configuredTokenHelper()
+	if err != nil {
+		return configPath, err
+	}
+	if helper != "" {
+		return storeWithHelper(helper, token)
+	}
+	tokenFile, err := tokenFilePath()
+	if err != nil {
+		return "token file", err
+	}
+	return storeInFile(tokenFile, token)
+}
+
+func storeWithHelper(helper, token string) (string, error) {
+	destination := fmt.Sprintf("token helper %s", helper)
+	if _, err := runTokenHelper(helper, "store", token); err != nil {
+		return destination, fmt.Errorf("Failed to store token with token helper %s: %s", helper, err)
+	}
+	return destination, nil
+}
+
+func storeInFile(path, token string) (string, error) {
+	if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+		return path, fmt.Errorf("Failed to write token file %s: %s", path, err)
+	}
+	return path, nil
+}
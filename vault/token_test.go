@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindToken(t *testing.T) {
+	home := t.TempDir()
+	helper := filepath.Join(home, "helper.sh")
+	helperScript := "#!/bin/sh\n[ \"$1\" = get ] && echo helper-token\n"
+	if err := os.WriteFile(helper, []byte(helperScript), 0o755); err != nil {
+		t.Fatalf("Failed to write token helper: %s", err)
+	}
+	tests := map[string]struct {
+		env       string
+		config    string
+		tokenFile string
+		token     string
+		source    string
+		err       string
+	}{
+		"env": {
+			env:       "env-token",
+			config:    fmt.Sprintf("token_helper = %q\n", helper),
+			tokenFile: "file-token",
+			token:     "env-token",
+			source:    "VAULT_TOKEN",
+		},
+		"helper": {
+			config:    fmt.Sprintf("token_helper = %q\n", helper),
+			tokenFile: "file-token",
+			token:     "helper-token",
+			source:    "token helper " + helper,
+		},
+		"file": {
+			tokenFile: "file-token\n",
+			token:     "file-token",
+			source:    filepath.Join(home, ".vault-token"),
+		},
+		"relative-helper": {
+			config: `token_helper = "helper.sh"`,
+			err:    "must be an absolute path",
+		},
+		"nothing": {
+			err: "No vault token found",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			t.Setenv("VAULT_CONFIG_PATH", "")
+			os.Unsetenv("VAULT_CONFIG_PATH")
+			os.Remove(filepath.Join(home, ".vault"))
+			os.Remove(filepath.Join(home, ".vault-token"))
+			if test.env != "" {
+				t.Setenv("VAULT_TOKEN", test.env)
+			} else {
+				t.Setenv("VAULT_TOKEN", "")
+				os.Unsetenv("VAULT_TOKEN")
+			}
+			if test.config != "" {
+				if err := os.WriteFile(filepath.Join(home, ".vault"), []byte(test.config), 0o644); err != nil {
+					t.Fatalf("Failed to write config: %s", err)
+				}
+			}
+			if test.tokenFile != "" {
+				if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte(test.tokenFile), 0o600); err != nil {
+					t.Fatalf("Failed to write token file: %s", err)
+				}
+			}
+			token, source, err := FindToken()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if token != test.token {
+				t.Fatalf("Expected token %s, got %s", test.token, token)
+			}
+			if source != test.source {
+				t.Fatalf("Expected source %s, got %s", test.source, source)
+			}
+		})
+	}
+}
+
+func TestGivenToken(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "env-token")
+	source := TokenSource{Token: "given-token"}
+	token, _, err := source.Find()
+	if err != nil || token != "given-token" {
+		t.Fatalf("Expected the given token, got %q and %v", token, err)
+	}
+	if _, err := source.Store("new-token"); err == nil {
+		t.Fatalf("Expected storing to a given token to fail")
+	}
+}
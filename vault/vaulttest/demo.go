@@ -0,0 +1,213 @@
+package vaulttest
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// DEMO_MOUNTS are the mounts that Populate spreads the secrets over
+var DEMO_MOUNTS = []string{"secret", "secret2", "secret3"}
+
+// Populate creates count secrets, at most len(KEYS), in random mounts with
+// random data. The same seed gives the same secrets. Some of them get a few
+// versions, one of them has its latest version deleted and a directory is
+// denied, to show how pole deals with that.
+func (s *Server) Populate(count int, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for _, mount := range DEMO_MOUNTS {
+		s.AddMount(mount)
+	}
+	for i, key := range KEYS[:min(count, len(KEYS))] {
+		mount := DEMO_MOUNTS[r.Intn(len(DEMO_MOUNTS))]
+		s.Put(mount, "/"+key, generateData(r))
+		if i%10 == 0 {
+			s.Put(mount, "/"+key, generateData(r))
+		}
+	}
+	s.Put("secret", "/restricted/admin", map[string]interface{}{"password": "hunter3"})
+	s.Deny("secret/metadata/restricted/")
+	version := s.Put("secret", "/deleted", map[string]interface{}{"gone": "soon"})
+	s.Delete("secret", "/deleted", version)
+}
+
+var (
+	// KEYS are the keys that Populate creates secrets at. shuf /usr/share/dict/words | head -150 plus some manuals for hierarchy
+	KEYS = []string{
+		"calculate/more/infinity",
+		"Rhapidophyllum/plant",
+		"intellectualist/smart/5head",
+		"Scyllaea/okay",
+		"excretive/extra/hierarchy",
+		"barbasco",
+		"tempest",
+		"subsinuous",
+		"undeficient",
+		"chairmaker",
+		"trituration",
+		"underbody",
+		"dipterologist",
+		"frailness",
+		"funerary",
+		"trisilane",
+		"carbocinchomeronic",
+		"refrain",
+		"adobe",
+		"suggillation",
+		"binodous",
+		"Invertebrata",
+		"balantidial",
+		"dullhead",
+		"Caliburn",
+		"ilicin",
+		"cadmium",
+		"Pharaonical",
+		"nonuterine",
+		"biocoenosis",
+		"recountenance",
+		"shalloon",
+		"croupy",
+		"apophantic",
+		"accredited",
+		"stook",
+		"unperflated",
+		"synoecism",
+		"Didelphidae",
+		"superstimulate",
+		"Darwinite",
+		"Miranda",
+		"flauntily",
+		"autoschediaze",
+		"abortifacient",
+		"cytogenic",
+		"veratroyl",
+		"unclamped",
+		"goatly",
+		"unchristianness",
+		"carbonation",
+		"unreverting",
+		"owse",
+		"topmost",
+		"unemployableness",
+		"cataclysmically",
+		"wheenge",
+		"anatropous",
+		"veridical",
+		"Pterodactyli",
+		"scepterless",
+		"broadspread",
+		"alchemical",
+		"drawlink",
+		"unbethink",
+		"isotopism",
+		"alcoholization",
+		"prooemion",
+		"Aberia",
+		"aldine",
+		"assurance",
+		"cytozoic",
+		"thelium",
+		"antiprostatic",
+		"feltmaker",
+		"concavely",
+		"Vishal",
+		"featherhead",
+		"cuminal",
+		"tetracolon",
+		"assert",
+		"Paphian",
+		"fountainously",
+		"lithium",
+		"snoek",
+		"theanthropology",
+		"Labyrinthula",
+		"topographer",
+		"surreptitiousness",
+		"axonophorous",
+		"subchelate",
+		"loxodromics",
+		"kapur",
+		"spiflicated",
+		"mnemonize",
+		"Lola",
+		"ultravirus",
+		"noncontent",
+		"seditionist",
+		"expensiveness",
+		"kirombo",
+		"subscriver",
+		"weaponshowing",
+		"gainful",
+		"persico",
+		"pelage",
+		"overlearnedness",
+		"syngenesian",
+		"preeze",
+		"prerefer",
+		"kittenish",
+		"hirer",
+		"gnawingly",
+		"unmoist",
+		"resubstitute",
+		"Actaeon",
+		"Leatheroid",
+		"unrecoined",
+		"pluricentral",
+		"misleadingly",
+		"pipe",
+		"Cycadaceae",
+		"upcall",
+		"flavid",
+		"mothed",
+		"rousting",
+		"repasser",
+		"isonitramine",
+		"heroarchy",
+		"stomacher",
+		"pseudoseptate",
+		"oxane",
+		"covellite",
+		"unscoffing",
+		"Brahmi",
+		"prolarva",
+		"narceine",
+		"underpose",
+		"depressant",
+		"undeviated",
+		"meromorphic",
+		"alumroot",
+		"propound",
+		"anthypophora",
+		"pomster",
+		"Scotlandwards",
+		"reschedule",
+		"syruplike",
+		"Gershom",
+		"bronchophthisis",
+	}
+	// DATA has the fields that the secrets get a random selection of
+	DATA = map[string]interface{}{
+		"username":   "psy",
+		"password":   "hunter2",
+		"oopa":       "gangnam",
+		"roles":      []string{"reader", "writer", "philantropist"},
+		"a":          "bcd, etc",
+		"bomb_at":    "2025-09-01",
+		"manifest":   "the industrial revolution and its consequences",
+		"free":       "palestine",
+		"max_memory": 640000,
+	}
+)
+
+func generateData(r *rand.Rand) map[string]interface{} {
+	fields := []string{}
+	for field := range DATA {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	data := map[string]interface{}{}
+	for range r.Intn(len(fields)) + 1 {
+		field := fields[r.Intn(len(fields))]
+		data[field] = DATA[field]
+	}
+	return data
+}
@@ -0,0 +1,433 @@
+// Package vaulttest is a vault server that keeps kv v2 secrets in memory, for
+// tests and demos. It serves the parts of the vault api that pole uses.
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an httptest.Server that answers like vault. Only the root token
+// and tokens from logging in are accepted.
+type Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	root    string
+	tokens  map[string]bool
+	mounts  map[string]map[string]*secret
+	denied  []string
+	latency time.Duration
+	logins  map[string]func(body map[string]string) bool
+}
+
+type secret struct {
+	versions []*version
+	custom   map[string]string
+}
+
+type version struct {
+	data         map[string]interface{}
+	createdTime  time.Time
+	deletionTime time.Time
+	destroyed    bool
+}
+
+// NewServer starts a server with a kv v2 mount called secret, like a vault
+// dev server. Close it when done.
+func NewServer(rootToken string) *Server {
+	s := NewUnstartedServer(rootToken)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer creates a server without starting it, so that its
+// Listener can be replaced, e.g. to listen on a fixed address
+func NewUnstartedServer(rootToken string) *Server {
+	s := &Server{
+		root:   rootToken,
+		tokens: map[string]bool{rootToken: true},
+		mounts: map[string]map[string]*secret{"secret": {}},
+		logins: make(map[string]func(body map[string]string) bool),
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddMount creates an empty kv v2 mount
+func (s *Server) AddMount(mount string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.mounts[mount]; !found {
+		s.mounts[mount] = make(map[string]*secret)
+	}
+}
+
+// Put writes a new version of the secret at key, e.g. /app/db, creating the
+// mount if needed. It returns the new version.
+func (s *Server) Put(mount, key string, data map[string]interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.mounts[mount]; !found {
+		s.mounts[mount] = make(map[string]*secret)
+	}
+	return s.put(mount, key, data)
+}
+
+func (s *Server) put(mount, key string, data map[string]interface{}) int {
+	sec, found := s.mounts[mount][key]
+	if !found {
+		sec = &secret{}
+		s.mounts[mount][key] = sec
+	}
+	sec.versions = append(sec.versions, &version{data: data, createdTime: time.Now().UTC()})
+	return len(sec.versions)
+}
+
+// SetCustomMetadata replaces the custom metadata of the secret at key,
+// creating the mount if needed
+func (s *Server) SetCustomMetadata(mount, key string, custom map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.mounts[mount]; !found {
+		s.mounts[mount] = make(map[string]*secret)
+	}
+	s.setCustomMetadata(mount, key, custom)
+}
+
+func (s *Server) setCustomMetadata(mount, key string, custom map[string]string) {
+	sec, found := s.mounts[mount][key]
+	if !found {
+		sec = &secret{}
+		s.mounts[mount][key] = sec
+	}
+	sec.custom = custom
+}
+
+// Delete soft deletes a version of the secret, which then gets 404 but keeps
+// its metadata
+func (s *Server) Delete(mount, key string, v int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sec, found := s.mounts[mount][key]; found && v >= 1 && v <= len(sec.versions) {
+		sec.versions[v-1].deletionTime = time.Now().UTC()
+	}
+}
+
+// Destroy removes the data of a version of the secret for good
+func (s *Server) Destroy(mount, key string, v int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sec, found := s.mounts[mount][key]; found && v >= 1 && v <= len(sec.versions) {
+		sec.versions[v-1].data = nil
+		sec.versions[v-1].destroyed = true
+	}
+}
+
+// Deny makes requests to paths that start with prefix fail with 403, e.g.
+// secret/metadata/team/ to hide a directory or secret/data/app to make a
+// secret unreadable. The prefix is matched against the api path without
+// /v1/.
+func (s *Server) Deny(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied = append(s.denied, prefix)
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// AddLogin enables logging in at auth/<mount>/login, and at
+// auth/<mount>/login/<username> where the username is added to the body.
+// check gets the body of the request and tells if the login succeeds.
+func (s *Server) AddLogin(mount string, check func(body map[string]string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins[mount] = check
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	time.Sleep(latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if strings.HasPrefix(path, "auth/") && strings.Contains(path, "/login") {
+		s.login(w, r, path)
+		return
+	}
+	if !s.tokens[r.Header.Get("X-Vault-Token")] || s.isDenied(path) {
+		writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	switch {
+	case path == "sys/internal/ui/mounts":
+		s.listMounts(w)
+	case path == "sys/capabilities-self":
+		s.capabilities(w, r)
+	case path == "auth/token/lookup-self":
+		policies := []string{"default"}
+		if r.Header.Get("X-Vault-Token") == s.root {
+			policies = []string{"root"}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+			"display_name": "token", "policies": policies, "ttl": 0, "renewable": false,
+		}})
+	case path == "auth/token/renew-self":
+		writeJSON(w, http.StatusOK, map[string]any{"auth": map[string]any{"lease_duration": 0}})
+	default:
+		s.kv(w, r, path)
+	}
+}
+
+func (s *Server) isDenied(path string) bool {
+	return slices.ContainsFunc(s.denied, func(prefix string) bool {
+		return strings.HasPrefix(path, prefix)
+	})
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request, path string) {
+	mount, rest, _ := strings.Cut(strings.TrimPrefix(path, "auth/"), "/login")
+	check, found := s.logins[mount]
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no handler for route %q", path))
+		return
+	}
+	body := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse JSON input: %s", err))
+		return
+	}
+	if username := strings.TrimPrefix(rest, "/"); username != "" {
+		body["username"] = username
+	}
+	if !check(body) {
+		writeError(w, http.StatusBadRequest, "invalid credentials")
+		return
+	}
+	token := fmt.Sprintf("fake-token-%d", len(s.tokens))
+	s.tokens[token] = true
+	writeJSON(w, http.StatusOK, map[string]any{"auth": map[string]any{"client_token": token}})
+}
+
+func (s *Server) listMounts(w http.ResponseWriter) {
+	mounts := map[string]any{}
+	for name := range s.mounts {
+		mounts[name+"/"] = map[string]any{"type": "kv", "options": map[string]string{"version": "2"}}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"secret": mounts}})
+}
+
+// capabilities allows everything on the paths that are not denied
+func (s *Server) capabilities(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Paths []string `json:"paths"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse JSON input: %s", err))
+		return
+	}
+	data := map[string][]string{}
+	for _, path := range body.Paths {
+		if s.isDenied(path) {
+			data[path] = []string{"deny"}
+		} else {
+			data[path] = []string{"root"}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+// kv serves <mount>/data/<key> and <mount>/metadata/<key>
+func (s *Server) kv(w http.ResponseWriter, r *http.Request, path string) {
+	mount, rest, _ := strings.Cut(path, "/")
+	kind, key, _ := strings.Cut(rest, "/")
+	key = "/" + key
+	secrets, found := s.mounts[mount]
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no handler for route %q", path))
+		return
+	}
+	switch {
+	case kind == "metadata" && (r.Method == "LIST" || r.URL.Query().Get("list") == "true"):
+		s.list(w, secrets, key)
+	case kind == "metadata" && r.Method == http.MethodGet:
+		s.metadata(w, secrets, key)
+	case kind == "metadata" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		s.writeMetadata(w, r, mount, key)
+	case kind == "metadata" && r.Method == http.MethodDelete:
+		delete(secrets, key)
+		w.WriteHeader(http.StatusNoContent)
+	case kind == "data" && r.Method == http.MethodGet:
+		s.read(w, r, secrets, key)
+	case kind == "data" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		s.write(w, r, mount, key)
+	case kind == "data" && r.Method == http.MethodDelete:
+		if sec, found := secrets[key]; found && len(sec.versions) > 0 {
+			sec.versions[len(sec.versions)-1].deletionTime = time.Now().UTC()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+// list answers with the keys and directories right below dir, directories
+// end with a slash
+func (s *Server) list(w http.ResponseWriter, secrets map[string]*secret, dir string) {
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	keys := []string{}
+	for key := range secrets {
+		name, found := strings.CutPrefix(key, dir)
+		if !found {
+			continue
+		}
+		if first, _, isDir := strings.Cut(name, "/"); isDir {
+			name = first + "/"
+		}
+		if !slices.Contains(keys, name) {
+			keys = append(keys, name)
+		}
+	}
+	if len(keys) == 0 {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	slices.Sort(keys)
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"keys": keys}})
+}
+
+func (s *Server) metadata(w http.ResponseWriter, secrets map[string]*secret, key string) {
+	sec, found := secrets[key]
+	if !found {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	versions := map[string]any{}
+	for i, v := range sec.versions {
+		versions[strconv.Itoa(i+1)] = v.metadata(i + 1)
+	}
+	createdTime, updatedTime := "", ""
+	if len(sec.versions) > 0 {
+		createdTime = sec.versions[0].createdTime.Format(time.RFC3339Nano)
+		updatedTime = sec.versions[len(sec.versions)-1].createdTime.Format(time.RFC3339Nano)
+	}
+	custom := sec.custom
+	if custom == nil {
+		custom = map[string]string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"current_version": len(sec.versions),
+		"created_time":    createdTime,
+		"updated_time":    updatedTime,
+		"custom_metadata": custom,
+		"versions":        versions,
+	}})
+}
+
+// writeMetadata sets the custom metadata of the secret, which doesn't have
+// to have any versions yet
+func (s *Server) writeMetadata(w http.ResponseWriter, r *http.Request, mount, key string) {
+	body := struct {
+		CustomMetadata map[string]string `json:"custom_metadata"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse JSON input: %s", err))
+		return
+	}
+	s.setCustomMetadata(mount, key, body.CustomMetadata)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// read answers with the latest version of the secret, or the one in the
+// version parameter. Deleted and destroyed versions get 404 with their
+// metadata, like in vault.
+func (s *Server) read(w http.ResponseWriter, r *http.Request, secrets map[string]*secret, key string) {
+	sec, found := secrets[key]
+	if !found || len(sec.versions) == 0 {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	n := len(sec.versions)
+	if param := r.URL.Query().Get("version"); param != "" && param != "0" {
+		var err error
+		n, err = strconv.Atoi(param)
+		if err != nil || n < 1 || n > len(sec.versions) {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+	}
+	v := sec.versions[n-1]
+	if v.destroyed || !v.deletionTime.IsZero() {
+		writeJSON(w, http.StatusNotFound, map[string]any{"data": map[string]any{"data": nil, "metadata": v.metadata(n)}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"data": v.data, "metadata": v.metadata(n)}})
+}
+
+// write adds a version of the secret. A cas option makes the write fail if
+// the current version is not cas, 0 meaning that the secret must not exist.
+func (s *Server) write(w http.ResponseWriter, r *http.Request, mount, key string) {
+	body := struct {
+		Data    map[string]interface{} `json:"data"`
+		Options struct {
+			CAS *int `json:"cas"`
+		} `json:"options"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse JSON input: %s", err))
+		return
+	}
+	if body.Data == nil {
+		writeError(w, http.StatusBadRequest, "no data provided")
+		return
+	}
+	current := 0
+	if sec, found := s.mounts[mount][key]; found {
+		current = len(sec.versions)
+	}
+	if body.Options.CAS != nil && *body.Options.CAS != current {
+		writeError(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+		return
+	}
+	n := s.put(mount, key, body.Data)
+	writeJSON(w, http.StatusOK, map[string]any{"data": s.mounts[mount][key].versions[n-1].metadata(n)})
+}
+
+func (v version) metadata(n int) map[string]any {
+	deletionTime := ""
+	if !v.deletionTime.IsZero() {
+		deletionTime = v.deletionTime.Format(time.RFC3339Nano)
+	}
+	return map[string]any{
+		"version":       n,
+		"created_time":  v.createdTime.Format(time.RFC3339Nano),
+		"deletion_time": deletionTime,
+		"destroyed":     v.destroyed,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers like vault does, 404 usually has no messages
+func writeError(w http.ResponseWriter, status int, messages ...string) {
+	writeJSON(w, status, map[string]any{"errors": append([]string{}, messages...)})
+}
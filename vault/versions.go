@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Version describes one version of a kv v2 secret
+type Version struct {
+	Version     int
+	CreatedTime time.Time
+	// DeletionTime is the zero time for versions that are not deleted
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// PutSecret writes a new version of the secret with the data
+func (c Client) PutSecret(ctx context.Context, mount, name string, data map[string]interface{}) error {
+	body := map[string]any{"data": data}
+	if err := c.doJSON(ctx, "POST", dataPath(mount, name), body, nil); err != nil {
+		return fmt.Errorf("Failed to write secret %s in %s: %s", name, mount, err)
+	}
+	c.forget(mount, name)
+	return nil
+}
+
+// Metadata describes a kv v2 secret and its versions
+type Metadata struct {
+	CurrentVersion int
+	CreatedTime    time.Time
+	// UpdatedTime is when the latest version was written
+	UpdatedTime time.Time
+	// CustomMetadata are the key value pairs that users have put on the
+	// secret, they are not versioned
+	CustomMetadata map[string]string
+	// Versions are sorted oldest first
+	Versions []Version
+}
+
+// GetMetadata gets the metadata of the secret
+func (c Client) GetMetadata(ctx context.Context, mount, name string) (Metadata, error) {
+	response := struct {
+		Data struct {
+			CurrentVersion int               `json:"current_version"`
+			CreatedTime    string            `json:"created_time"`
+			UpdatedTime    string            `json:"updated_time"`
+			CustomMetadata map[string]string `json:"custom_metadata"`
+			Versions       map[string]struct {
+				CreatedTime  string `json:"created_time"`
+				DeletionTime string `json:"deletion_time"`
+				Destroyed    bool   `json:"destroyed"`
+			} `json:"versions"`
+		} `json:"data"`
+	}{}
+	if err := c.doJSON(ctx, "GET", metadataPath(mount, name), nil, &response); err != nil {
+		return Metadata{}, fmt.Errorf("Failed to get metadata of %s in %s: %s", name, mount, err)
+	}
+	metadata := Metadata{
+		CurrentVersion: response.Data.CurrentVersion,
+		CustomMetadata: response.Data.CustomMetadata,
+		Versions:       []Version{},
+	}
+	metadata.CreatedTime, _ = time.Parse(time.RFC3339Nano, response.Data.CreatedTime)
+	metadata.UpdatedTime, _ = time.Parse(time.RFC3339Nano, response.Data.UpdatedTime)
+	for number, v := range response.Data.Versions {
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("Failed to parse version %s of %s in %s: %s", number, name, mount, err)
+		}
+		version := Version{Version: n, Destroyed: v.Destroyed}
+		// Vault leaves deletion_time empty for versions that are not deleted
+		version.CreatedTime, _ = time.Parse(time.RFC3339Nano, v.CreatedTime)
+		version.DeletionTime, _ = time.Parse(time.RFC3339Nano, v.DeletionTime)
+		metadata.Versions = append(metadata.Versions, version)
+	}
+	slices.SortFunc(metadata.Versions, func(a, b Version) int {
+		return a.Version - b.Version
+	})
+	return metadata, nil
+}
+
+// PutCustomMetadata replaces the custom metadata of the secret
+func (c Client) PutCustomMetadata(ctx context.Context, mount, name string, custom map[string]string) error {
+	body := map[string]any{"custom_metadata": custom}
+	if err := c.doJSON(ctx, "POST", metadataPath(mount, name), body, nil); err != nil {
+		return fmt.Errorf("Failed to write metadata of %s in %s: %s", name, mount, err)
+	}
+	return nil
+}
+
+// GetVersions lists the versions of the secret, oldest first
+func (c Client) GetVersions(ctx context.Context, mount, name string) ([]Version, error) {
+	metadata, err := c.GetMetadata(ctx, mount, name)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Versions, nil
+}
+
+// GetSecretVersion gets an earlier version of the secret. Deleted and
+// destroyed versions have no data.
+func (c Client) GetSecretVersion(ctx context.Context, mount, name string, version int) (Secret, error) {
+	response, body, err := c.do(ctx, "GET", fmt.Sprintf("%s?version=%d", dataPath(mount, name), version), nil)
+	if err != nil {
+		return Secret{}, fmt.Errorf("Failed to get version %d of %s in %s: %s", version, name, mount, err)
+	}
+	var secret Secret
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return Secret{}, fmt.Errorf("Failed to parse version %d of %s in %s: %s", version, name, mount, err)
+	}
+	// Like in GetSecret, a 404 with metadata is a deleted version
+	if response.StatusCode != 200 && secret.Data.Metadata == nil {
+		return Secret{}, fmt.Errorf("Failed to get version %d of %s in %s: %s", version, name, mount, responseError(response, body))
+	}
+	secret.Url = fmt.Sprintf("%s/ui/vault/secrets/%s/show%s?version=%d", c.Addr, mount, name, version)
+	secret.Cli = fmt.Sprintf("vault kv get -mount=%s -version=%d %s", mount, version, name)
+	return secret, nil
+}
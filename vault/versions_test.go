@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/slarwise/pole/vault/vaulttest"
+)
+
+func TestVersions(t *testing.T) {
+	written := map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1/kv/data/app":
+			if err := json.NewDecoder(r.Body).Decode(&written); err != nil {
+				t.Fatalf("Failed to decode request: %s", err)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"version": 3}})
+		case r.URL.Path == "/v1/kv/metadata/app":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"versions": map[string]any{
+				"2":  map[string]any{"created_time": "2024-01-02T00:00:00Z", "deletion_time": "2024-01-03T00:00:00Z", "destroyed": false},
+				"10": map[string]any{"created_time": "2024-01-10T00:00:00Z", "deletion_time": "", "destroyed": false},
+				"1":  map[string]any{"created_time": "2024-01-01T00:00:00Z", "deletion_time": "", "destroyed": true},
+			}}})
+		case r.URL.Path == "/v1/kv/data/app" && r.URL.Query().Get("version") == "1":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": map[string]any{"user": "old"}, "metadata": map[string]any{"version": 1}}})
+		case r.URL.Path == "/v1/kv/data/app" && r.URL.Query().Get("version") == "2":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": nil, "metadata": map[string]any{"version": 2}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	if err := client.PutSecret(context.Background(), "kv", "/app", map[string]interface{}{"user": "new"}); err != nil {
+		t.Fatalf("Got unexpected error when writing: %s", err)
+	}
+	if data, ok := written["data"].(map[string]any); !ok || data["user"] != "new" {
+		t.Fatalf("Expected the data to be sent in a data object, got %v", written)
+	}
+
+	versions, err := client.GetVersions(context.Background(), "kv", "/app")
+	if err != nil {
+		t.Fatalf("Got unexpected error when getting versions: %s", err)
+	}
+	numbers := []int{}
+	for _, v := range versions {
+		numbers = append(numbers, v.Version)
+	}
+	if !slices.Equal(numbers, []int{1, 2, 10}) {
+		t.Fatalf("Expected versions [1 2 10], got %v", numbers)
+	}
+	if !versions[0].Destroyed || !versions[0].DeletionTime.IsZero() {
+		t.Fatalf("Expected version 1 to be destroyed, got %+v", versions[0])
+	}
+	if !versions[1].DeletionTime.Equal(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected version 2 to be deleted, got %+v", versions[1])
+	}
+
+	secret, err := client.GetSecretVersion(context.Background(), "kv", "/app", 1)
+	if err != nil {
+		t.Fatalf("Got unexpected error when getting version 1: %s", err)
+	}
+	if secret.Data.Data["user"] != "old" {
+		t.Fatalf("Expected the data of version 1, got %v", secret.Data.Data)
+	}
+	secret, err = client.GetSecretVersion(context.Background(), "kv", "/app", 2)
+	if err != nil {
+		t.Fatalf("Got unexpected error when getting deleted version 2: %s", err)
+	}
+	if secret.Data.Data != nil {
+		t.Fatalf("Expected no data for deleted version 2, got %v", secret.Data.Data)
+	}
+	if _, err := client.GetSecretVersion(context.Background(), "kv", "/app", 5); err == nil {
+		t.Fatalf("Expected an error for a version that doesn't exist")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	server := vaulttest.NewServer(token)
+	defer server.Close()
+	server.Put("secret", "/app", map[string]interface{}{"user": "a"})
+	server.Put("secret", "/app", map[string]interface{}{"user": "b"})
+	client := NewClient(server.URL, WithToken(token))
+
+	custom := map[string]string{"owner": "team-a"}
+	if err := client.PutCustomMetadata(context.Background(), "secret", "/app", custom); err != nil {
+		t.Fatalf("Got unexpected error when writing metadata: %s", err)
+	}
+	metadata, err := client.GetMetadata(context.Background(), "secret", "/app")
+	if err != nil {
+		t.Fatalf("Got unexpected error when getting metadata: %s", err)
+	}
+	if metadata.CurrentVersion != 2 || len(metadata.Versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %+v", metadata)
+	}
+	if !metadata.UpdatedTime.Equal(metadata.Versions[1].CreatedTime) || metadata.CreatedTime.After(metadata.UpdatedTime) {
+		t.Fatalf("Expected the secret to be updated when version 2 was created, got %+v", metadata)
+	}
+	if metadata.CustomMetadata["owner"] != "team-a" {
+		t.Fatalf("Expected custom metadata %v, got %v", custom, metadata.CustomMetadata)
+	}
+}